@@ -1,11 +1,21 @@
 module github.com/jlamillan/docker-machine-driver-oci
 
 require (
-	github.com/docker/docker v1.13.1 // indirect
-	github.com/oracle/oci-go-sdk v13.0.0+incompatible
+	github.com/oracle/oci-go-sdk/v65 v65.64.0
 	github.com/rancher/machine v0.15.0-rancher30
-	github.com/stretchr/testify v0.0.0-20160221104443-1f4a1643a57e
-	golang.org/x/crypto v0.0.0-20200117160349-530e935923ad
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.14.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/docker/docker v1.13.1 // indirect
+	github.com/gofrs/flock v0.8.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/sony/gobreaker v0.5.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/term v0.13.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-go 1.13
+go 1.17
@@ -1,11 +1,45 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
 	"github.com/jlamillan/docker-machine-driver-oci/pkg/drivers/oci"
 	"github.com/rancher/machine/libmachine/drivers/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate-credentials" {
+		migrateCredentials(os.Args[2:])
+		return
+	}
 	plugin.RegisterDriver(oci.NewDriver("", ""))
 }
 
+// migrateCredentials replaces the API key and passphrase stored in the config of existing
+// machines with references to them.
+func migrateCredentials(args []string) {
+	defaultStorePath := os.Getenv("MACHINE_STORAGE_PATH")
+	if defaultStorePath == "" {
+		home, _ := os.UserHomeDir()
+		defaultStorePath = filepath.Join(home, ".docker", "machine")
+	}
+
+	flags := flag.NewFlagSet("migrate-credentials", flag.ExitOnError)
+	storePath := flags.String("storage-path", defaultStorePath, "machine store to migrate")
+	machineName := flags.String("machine", "", "only migrate the named machine")
+	privateKeyRef := flags.String("private-key-ref", "", "reference to the private API key (file:<path>, env:<name> or vault:<secret OCID>)")
+	passphraseRef := flags.String("private-key-passphrase-ref", "", "reference to the private API key passphrase")
+	flags.Parse(args)
+
+	migrated, err := oci.MigrateStoreCredentials(*storePath, *machineName, *privateKeyRef, *passphraseRef)
+	for _, name := range migrated {
+		fmt.Printf("Migrated %s\n", name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate-credentials: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,22 +1,21 @@
 package oci
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"github.com/oracle/oci-go-sdk/common"
-	"github.com/oracle/oci-go-sdk/core"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
 	"github.com/rancher/machine/libmachine/drivers"
 	"github.com/rancher/machine/libmachine/log"
 	"github.com/rancher/machine/libmachine/mcnflag"
 	"github.com/rancher/machine/libmachine/state"
-	"golang.org/x/crypto/ssh"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const (
@@ -25,34 +24,138 @@ const (
 	defaultSSHUser     = "opc"
 	defaultImage       = "Oracle-Linux-7.7"
 	defaultDockerPort  = 2376
-	sshBitLen          = 4096
+
+	// terminatedByDriverTag marks preemptible instances terminated by the driver.
+	terminatedByDriverTag = "rancher-terminated-by-driver"
 )
 
 // Driver is the implementation of BaseDriver interface
 type Driver struct {
 	*drivers.BaseDriver
-	AvailabilityDomain   string
-	DockerPort           int
-	Fingerprint          string
-	Image                string
-	NodeCompartmentID    string
-	PrivateKeyContents   string
-	PrivateKeyPassphrase string
-	PrivateKeyPath       string
-	Region               string
-	Shape                string
-	SubnetID             string
-	TenancyID            string
-	UserID               string
-	VCNCompartmentID     string
-	VCNID                string
-	IsRover              bool
-	RoverComputeEndpoint string
-	RoverNetworkEndpoint string
-	RoverCertPath        string
-	RoverCertContent     string
+	AvailabilityDomain    string
+	DockerPort            int
+	Fingerprint           string
+	Image                 string
+	NodeCompartmentID     string
+	PrivateKeyContents    string
+	PrivateKeyPassphrase  string
+	PrivateKeyPath        string
+	Region                string
+	Shape                 string
+	SubnetID              string
+	TenancyID             string
+	UserID                string
+	VCNCompartmentID      string
+	VCNID                 string
+	IsRover               bool
+	RoverComputeEndpoint  string
+	RoverNetworkEndpoint  string
+	RoverIdentityEndpoint string
+	RoverAddress          string
+	RoverCertPath         string
+	RoverCertContent      string
+	NodeNSGIDs            []string
+	ManageNSGs            bool
+	NSGClusterName        string
+	NodeRoles             []string
+	NSGSourceCIDR         string
+	AssignPublicIP        string
+	UsePrivateIP          bool
+	NodePrivateIP         string
+	ReservedPublicIP      string
+	PublicIPPool          string
+	KeepReservedPublicIP  bool
+	SecondaryVnics        []SecondaryVnic
+	SecondaryPrivateIPs   []string
+	AssignIPv6            bool
+	NodeIPv6Address       string
+	PreferIPv6            bool
+	NodeHostnameLabel     string
+	UseFQDN               bool
+	DisplayNameTemplate   string
+	NodeLabels            map[string]string
+	Preemptible           bool
+	PreserveBootVolume    bool
+	FaultDomain           string
+	// Credential references, persisted instead of the credentials
+	PrivateKeyRef           string
+	PrivateKeyPassphraseRef string
+	// Endpoints, TLS and proxy
+	ComputeEndpoint      string
+	NetworkEndpoint      string
+	IdentityEndpoint     string
+	BlockStorageEndpoint string
+	RealmDomain          string
+	CABundlePath         string
+	CABundleContent      string
+	AllowUnknownRegion   bool
+	ProxyURL             string
+	ProxyUsername        string
+	ProxyPassword        string `json:"-"`
+	ProxyPasswordPath    string
+	NoProxy              string
+	ClientCertPath       string
+	ClientCertContent    string
+	ClientKeyPath        string
+	ClientKeyContent     string `json:"-"`
+	// Placement
+	CapacityReservationID       string
+	CapacityReservationFallback string
+	DedicatedVMHostID           string
+	ComputeClusterID            string
+	ClusterPlacementGroupID     string
+	// Shielded instances, confidential computing and launch modes
+	SecureBoot            bool
+	MeasuredBoot          bool
+	TrustedPlatformModule bool
+	MemoryEncryption      bool
+	NetworkType           string
+	BootVolumeType        string
+	BootVolumeSize        int
+	// Oracle Cloud Agent
+	AgentMonitoring string
+	AgentManagement string
+	AgentPlugins    []AgentPlugin
+	// Bastion service
+	BastionID          string
+	BastionSessionType string
+	BastionSessionTTL  int
+	// Jump host
+	JumpHost            string
+	JumpHostUser        string
+	JumpHostPort        int
+	JumpHostKeyPath     string
+	JumpHostKeyContents string `json:"-"`
+	JumpHostKnownHosts  string
+	SSHKeyType          string
+	// Instance console: host key pinning and boot diagnostics
+	PinHostKeys    bool
+	HostKeyTimeout int
+	CaptureConsole bool
+	// Lookup cache
+	LookupCacheTTL    int
+	BypassLookupCache bool
 	// Runtime values
-	InstanceID string
+	InstanceID         string
+	ManagedNSGIDs      []string
+	ReservedPublicIPID string
+	IPv6Address        string
+	HostnameLabel      string
+	FQDN               string
+	DisplayName        string
+	BastionSessionID   string
+
+	// skipCapacityReservation is set by PreCreateCheck when the reservation is full
+	// and the fallback policy allows launching on regular capacity.
+	skipCapacityReservation bool
+	// sshTunnelPort is the local port forwarded to the node through the bastion session or jump host.
+	sshTunnelPort int
+	sshTunnelLock sync.Mutex
+	// client caches the OCI clients across calls; it is rebuilt when clientKey no longer
+	// matches the configuration.
+	client     *Client
+	clientKey  string
+	clientLock sync.Mutex
 }
 
 // NewDriver creates a new driver
@@ -76,13 +179,7 @@ func (d *Driver) Create() error {
 	}
 
 	// Create SSH key-pair
-	privateKey, err := generatePrivateKey(sshBitLen)
-	if err != nil {
-		return err
-	}
-	privateKeyBytes := encodePEM(privateKey)
-
-	publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
+	privateKeyBytes, publicKeyBytes, err := generateSSHKeyPair(d.SSHKeyType)
 	if err != nil {
 		return err
 	}
@@ -99,13 +196,126 @@ func (d *Driver) Create() error {
 		return err
 	}
 
+	err = ioutil.WriteFile(d.GetSSHKeyPath()+".pub", publicKeyBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	d.DisplayName, err = renderDisplayName(d, suffix)
+	if err != nil {
+		return err
+	}
+
+	d.HostnameLabel = d.NodeHostnameLabel
+	if d.HostnameLabel == "" {
+		d.HostnameLabel, err = oci.GenerateHostnameLabel(d.SubnetID, d.MachineName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.ManageNSGs {
+		err = d.ensureManagedNSGs(oci)
+		if err != nil {
+			return err
+		}
+	}
+
 	d.InstanceID, err = oci.CreateInstance(d, string(publicKeyBytes))
+	if err != nil && d.ManageNSGs && isNotFound(err) {
+		// The last node of the cluster may have deleted the NSGs since they were looked up.
+		log.Infof("Could not launch instance (%s), retrying with recreated network security groups", d.redact(err.Error()))
+		err = d.ensureManagedNSGs(oci)
+		if err != nil {
+			return err
+		}
+		d.InstanceID, err = oci.CreateInstance(d, string(publicKeyBytes))
+	}
 	if err != nil {
 		return err
 	}
 
+	err = d.configureInstance(oci)
+	if err == nil {
+		// Wait for SSH here rather than in the provisioner, so that a node that never
+		// becomes reachable has its console captured too.
+		err = drivers.WaitForSSH(d)
+	}
+	if err != nil {
+		return d.withConsoleLog(oci, err)
+	}
+	if d.CaptureConsole {
+		if _, err := d.saveConsoleLog(oci); err != nil {
+			log.Warnf("Could not capture console history of instance %s: %v", d.InstanceID, err)
+		}
+	}
+
+	return nil
+}
+
+// ensureManagedNSGs finds or creates the managed NSGs of the node's cluster and sets
+// the NSGs of the node's roles.
+func (d *Driver) ensureManagedNSGs(oci Client) error {
+	nsgIDs, err := oci.EnsureClusterNSGs(d.VCNCompartmentID, d.VCNID, d.NSGClusterName, d.NSGSourceCIDR)
+	if err != nil {
+		return err
+	}
+	d.ManagedNSGIDs = nil
+	for _, role := range d.NodeRoles {
+		d.ManagedNSGIDs = append(d.ManagedNSGIDs, nsgIDs[role])
+	}
+	return nil
+}
+
+// configureInstance finishes setting up a launched instance.
+func (d *Driver) configureInstance(oci Client) error {
+	var err error
+	if len(d.SecondaryPrivateIPs) > 0 {
+		err = oci.AssignSecondaryPrivateIPs(d.InstanceID, d.NodeCompartmentID, d.SecondaryPrivateIPs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(d.SecondaryVnics) > 0 {
+		err = oci.AttachSecondaryVnics(d.InstanceID, d.DisplayName, d.SecondaryVnics)
+		if err != nil {
+			return err
+		}
+	}
+
+	// No block storage endpoint is configured for rover devices, so their boot volumes keep
+	// the name given by the device.
+	if !d.IsRover {
+		err = oci.SetBootVolumeDisplayName(d.InstanceID, d.DisplayName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.AssignPublicIP == assignPublicIPReserved {
+		d.ReservedPublicIPID, err = oci.AssignReservedPublicIP(d.InstanceID, d.NodeCompartmentID, d.DisplayName, d.ReservedPublicIP, d.PublicIPPool)
+		if err != nil {
+			return err
+		}
+	}
+
 	ip, _ := d.GetIP()
 	log.Infof("created instance ID %s, IP address %s", d.InstanceID, ip)
+	if d.AssignIPv6 {
+		ipv6, _ := d.GetIPv6()
+		log.Infof("instance ID %s has IPv6 address %s", d.InstanceID, ipv6)
+	}
+
+	if d.PinHostKeys {
+		if err := d.pinHostKeys(oci); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -123,7 +333,7 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
 		mcnflag.StringFlag{
 			Name:   "oci-node-availability-domain",
-			Usage:  "Specify availability domain the node(s) should use",
+			Usage:  "Specify availability domain the node(s) should use, discovered from the device for rover nodes if not set",
 			EnvVar: "OCI_NODE_AVAILABILITY_DOMAIN",
 		},
 		mcnflag.IntFlag{
@@ -168,6 +378,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Specify private API key path for the specified OCI user, in PEM format",
 			EnvVar: "OCI_PRIVATE_KEY_PATH",
 		},
+		mcnflag.StringFlag{
+			Name:   "oci-private-key-ref",
+			Usage:  "Specify reference to the private API key (file:<path>, env:<name> or vault:<secret OCID>), stored instead of the key itself",
+			EnvVar: "OCI_PRIVATE_KEY_REF",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-private-key-passphrase-ref",
+			Usage:  "Specify reference to the private API key passphrase (file:<path>, env:<name> or vault:<secret OCID>), stored instead of the passphrase itself",
+			EnvVar: "OCI_PRIVATE_KEY_PASSPHRASE_REF",
+		},
 		mcnflag.StringFlag{
 			Name:   "oci-private-key-passphrase",
 			Usage:  "Specify passphrase (if any) that protects private key file the specified OCI user",
@@ -196,6 +416,12 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "OCI_SSH_USER",
 			Value:  defaultSSHUser,
 		},
+		mcnflag.StringFlag{
+			Name:   "oci-ssh-key-type",
+			Usage:  "Specify type of the SSH key generated for the node(s): " + strings.Join(sshKeyTypes, ", "),
+			EnvVar: "OCI_SSH_KEY_TYPE",
+			Value:  defaultSSHKeyType,
+		},
 		mcnflag.StringFlag{
 			Name:   "oci-subnet-id",
 			Usage:  "Specify pre-existing subnet id in which you want to create the node(s)",
@@ -228,16 +454,111 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Specify if the plugin is used for a oci rover device",
 			EnvVar: "OCI_IS_ROVER",
 		},
+		mcnflag.StringFlag{
+			Name:   "oci-compute-endpoint",
+			Usage:  "Specify custom endpoint of the Compute service, e.g. https://iaas.us-langley-1.oraclegovcloud.com",
+			EnvVar: "OCI_COMPUTE_ENDPOINT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-network-endpoint",
+			Usage:  "Specify custom endpoint of the Networking service",
+			EnvVar: "OCI_NETWORK_ENDPOINT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-identity-endpoint",
+			Usage:  "Specify custom endpoint of the Identity service",
+			EnvVar: "OCI_IDENTITY_ENDPOINT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-block-storage-endpoint",
+			Usage:  "Specify custom endpoint of the Block Storage service",
+			EnvVar: "OCI_BLOCK_STORAGE_ENDPOINT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-realm-domain",
+			Usage:  "Specify second-level domain of the realm for endpoints of all services, e.g. oraclegovcloud.com, for realms unknown to the driver",
+			EnvVar: "OCI_REALM_DOMAIN",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-ca-bundle-path",
+			Usage:  "Specify path of a PEM bundle of additional CA certificates to trust for all endpoints",
+			EnvVar: "OCI_CA_BUNDLE_PATH",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-ca-bundle-content",
+			Usage:  "Specify PEM bundle of additional CA certificates to trust for all endpoints",
+			EnvVar: "OCI_CA_BUNDLE_CONTENT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-proxy-url",
+			Usage:  "Specify URL of an HTTP proxy for OCI API traffic, e.g. http://proxy.example.com:3128, defaults to the proxy environment variables",
+			EnvVar: "OCI_PROXY_URL",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-proxy-username",
+			Usage:  "Specify user name to authenticate to the proxy with",
+			EnvVar: "OCI_PROXY_USERNAME",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-proxy-password",
+			Usage:  "Specify password to authenticate to the proxy with",
+			EnvVar: "OCI_PROXY_PASSWORD",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-proxy-password-path",
+			Usage:  "Specify path of a file holding the password to authenticate to the proxy with",
+			EnvVar: "OCI_PROXY_PASSWORD_PATH",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-no-proxy",
+			Usage:  "Specify comma-separated hosts, domains and CIDR blocks to reach without the proxy",
+			EnvVar: "OCI_NO_PROXY",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-client-cert-path",
+			Usage:  "Specify path of a client certificate to present to OCI API endpoints (mutual TLS), in PEM format",
+			EnvVar: "OCI_CLIENT_CERT_PATH",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-client-cert-content",
+			Usage:  "Specify client certificate to present to OCI API endpoints (mutual TLS), in PEM format",
+			EnvVar: "OCI_CLIENT_CERT_CONTENT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-client-key-path",
+			Usage:  "Specify path of the private key of the client certificate, in PEM format",
+			EnvVar: "OCI_CLIENT_KEY_PATH",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-client-key-content",
+			Usage:  "Specify private key of the client certificate, in PEM format",
+			EnvVar: "OCI_CLIENT_KEY_CONTENT",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-allow-unknown-region",
+			Usage:  "Allow a region that is not known to the driver, e.g. a new or dedicated region",
+			EnvVar: "OCI_ALLOW_UNKNOWN_REGION",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-rover-address",
+			Usage:  "Specify host name or IP address (and optional port) of the rover device to derive its endpoints from",
+			EnvVar: "OCI_ROVER_ADDRESS",
+		},
 		mcnflag.StringFlag{
 			Name:   "oci-rover-compute-endpoint",
-			Usage:  "Specify compute endpoint for rover",
+			Usage:  "Specify compute endpoint for rover, derived from --oci-rover-address if not set",
 			EnvVar: "OCI_ROVER_COMPUTE_ENDPOINT",
 		},
 		mcnflag.StringFlag{
 			Name:   "oci-rover-network-endpoint",
-			Usage:  "SSpecify network endpoint for rover",
+			Usage:  "Specify network endpoint for rover, derived from --oci-rover-address if not set",
 			EnvVar: "OCI_ROVER_NETWORK_ENDPOINT",
 		},
+		mcnflag.StringFlag{
+			Name:   "oci-rover-identity-endpoint",
+			Usage:  "Specify identity endpoint for rover, used to discover availability domains, derived from --oci-rover-address if not set",
+			EnvVar: "OCI_ROVER_IDENTITY_ENDPOINT",
+		},
 		mcnflag.StringFlag{
 			Name:   "oci-rover-cert-path",
 			Usage:  "Specify rover cert key path for the specified OCI user, in PEM format",
@@ -248,6 +569,275 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Specify rover cert key content for the specified OCI user, in PEM format",
 			EnvVar: "OCI_ROVER_CERT_CONTENT",
 		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-node-nsg-ids",
+			Usage:  "Specify OCIDs of pre-existing network security groups the node(s) should be attached to",
+			EnvVar: "OCI_NODE_NSG_IDS",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-nsg-managed",
+			Usage:  "Specify if the driver should create and attach per-role network security groups for the cluster",
+			EnvVar: "OCI_NSG_MANAGED",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-nsg-cluster-name",
+			Usage:  "Specify name of the cluster, used to identify its managed network security groups",
+			EnvVar: "OCI_NSG_CLUSTER_NAME",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-node-roles",
+			Usage:  "Specify Kubernetes roles of the node(s) (etcd, controlplane, worker), used to select managed network security groups",
+			EnvVar: "OCI_NODE_ROLES",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-nsg-source-cidr",
+			Usage:  "Specify CIDR allowed to reach the SSH, Docker, API and ingress ports in managed network security groups",
+			Value:  anywhereCIDR,
+			EnvVar: "OCI_NSG_SOURCE_CIDR",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-assign-public-ip",
+			Usage:  "Specify whether the node(s) get a public IP (true, false or reserved), defaults to the subnet's setting",
+			EnvVar: "OCI_NODE_ASSIGN_PUBLIC_IP",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-use-private-ip",
+			Usage:  "Specify if the node(s) should be reached on their private IP, even when they have a public IP",
+			EnvVar: "OCI_USE_PRIVATE_IP",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-private-ip",
+			Usage:  "Specify static private IP address the node should use in its subnet",
+			EnvVar: "OCI_NODE_PRIVATE_IP",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-reserved-public-ip-id",
+			Usage:  "Specify OCID of a pre-existing reserved public IP to assign to the node (implies --oci-node-assign-public-ip reserved)",
+			EnvVar: "OCI_NODE_RESERVED_PUBLIC_IP_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-public-ip-pool",
+			Usage:  "Specify name or OCID of the public IP pool to allocate reserved public IPs from (implies --oci-node-assign-public-ip reserved)",
+			EnvVar: "OCI_NODE_PUBLIC_IP_POOL",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-keep-reserved-public-ip",
+			Usage:  "Specify if the reserved public IP allocated for the node should be kept (and reused when the node is recreated) on removal",
+			EnvVar: "OCI_NODE_KEEP_RESERVED_PUBLIC_IP",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-node-secondary-vnic",
+			Usage:  "Specify a secondary VNIC to attach to the node(s) as subnet=<ocid>[,nsg=<ocid>...][,private-ip=<address>], can be repeated",
+			EnvVar: "OCI_NODE_SECONDARY_VNIC",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-node-secondary-private-ip",
+			Usage:  "Specify a secondary private IP address (or auto) to assign to the primary VNIC of the node(s), can be repeated",
+			EnvVar: "OCI_NODE_SECONDARY_PRIVATE_IP",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-assign-ipv6",
+			Usage:  "Specify if the node(s) should get an IPv6 address, requires an IPv6-enabled subnet",
+			EnvVar: "OCI_NODE_ASSIGN_IPV6",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-ipv6-address",
+			Usage:  "Specify static IPv6 address the node should use in its subnet (implies --oci-node-assign-ipv6)",
+			EnvVar: "OCI_NODE_IPV6_ADDRESS",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-prefer-ipv6",
+			Usage:  "Specify if the node(s) should be reached on their IPv6 address (implies --oci-node-assign-ipv6)",
+			EnvVar: "OCI_PREFER_IPV6",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-hostname-label",
+			Usage:  "Specify hostname label of the node in its subnet's DNS domain, defaults to a label derived from the machine name",
+			EnvVar: "OCI_NODE_HOSTNAME_LABEL",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-use-fqdn",
+			Usage:  "Specify if the node(s) should be reached over SSH on their FQDN in the subnet's DNS domain instead of an IP",
+			EnvVar: "OCI_USE_FQDN",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-display-name-template",
+			Usage:  "Specify Go template for the display name of the node(s), with .MachineName, .Labels, .Region, .AvailabilityDomain and .Suffix (random)",
+			Value:  defaultDisplayNameTemplate,
+			EnvVar: "OCI_NODE_DISPLAY_NAME_TEMPLATE",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-node-labels",
+			Usage:  "Specify key=value labels (e.g. cluster or pool) available to the display name template as .Labels, can be repeated",
+			EnvVar: "OCI_NODE_LABELS",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-preemptible",
+			Usage:  "Specify if the node(s) should run on preemptible capacity, which OCI may reclaim at any time",
+			EnvVar: "OCI_NODE_PREEMPTIBLE",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-preserve-boot-volume-on-preemption",
+			Usage:  "Specify if the boot volume of a preemptible node should be kept when the node is preempted",
+			EnvVar: "OCI_NODE_PRESERVE_BOOT_VOLUME_ON_PREEMPTION",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-fault-domain",
+			Usage:  "Specify fault domain the node(s) should use, e.g. FAULT-DOMAIN-1",
+			EnvVar: "OCI_NODE_FAULT_DOMAIN",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-capacity-reservation-id",
+			Usage:  "Specify OCID of the compute capacity reservation to launch the node(s) into",
+			EnvVar: "OCI_NODE_CAPACITY_RESERVATION_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-capacity-reservation-fallback",
+			Usage:  "Specify what to do when the capacity reservation is full: fail, or on-demand to launch on regular capacity",
+			Value:  capacityFallbackFail,
+			EnvVar: "OCI_NODE_CAPACITY_RESERVATION_FALLBACK",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-dedicated-vm-host-id",
+			Usage:  "Specify OCID of the dedicated virtual machine host to place the node(s) on",
+			EnvVar: "OCI_NODE_DEDICATED_VM_HOST_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-compute-cluster-id",
+			Usage:  "Specify OCID of the compute cluster to launch the node(s) into",
+			EnvVar: "OCI_NODE_COMPUTE_CLUSTER_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-cluster-placement-group-id",
+			Usage:  "Specify OCID of the cluster placement group to launch the node(s) into",
+			EnvVar: "OCI_NODE_CLUSTER_PLACEMENT_GROUP_ID",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-secure-boot",
+			Usage:  "Specify if Secure Boot should be enabled on the node(s) (shielded instance)",
+			EnvVar: "OCI_NODE_SECURE_BOOT",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-measured-boot",
+			Usage:  "Specify if Measured Boot should be enabled on the node(s) (shielded instance)",
+			EnvVar: "OCI_NODE_MEASURED_BOOT",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-tpm",
+			Usage:  "Specify if the Trusted Platform Module should be enabled on the node(s) (shielded instance)",
+			EnvVar: "OCI_NODE_TPM",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-node-memory-encryption",
+			Usage:  "Specify if memory encryption (AMD SEV confidential computing) should be enabled on the node(s)",
+			EnvVar: "OCI_NODE_MEMORY_ENCRYPTION",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-network-type",
+			Usage:  "Specify emulation type of the node(s) physical network interface card (PARAVIRTUALIZED, VFIO or E1000), defaults to the image's launch mode",
+			EnvVar: "OCI_NODE_NETWORK_TYPE",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-node-boot-volume-type",
+			Usage:  "Specify emulation type of the node(s) boot volume (PARAVIRTUALIZED, VFIO, ISCSI, SCSI or IDE), defaults to the image's launch mode",
+			EnvVar: "OCI_NODE_BOOT_VOLUME_TYPE",
+		},
+		mcnflag.IntFlag{
+			Name:   "oci-node-boot-volume-size",
+			Usage:  "Specify size of the node(s) boot volume in GB (50 to 32768), defaults to the image's size (50 GB on rover devices)",
+			EnvVar: "OCI_NODE_BOOT_VOLUME_SIZE",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-agent-monitoring",
+			Usage:  "Specify if Oracle Cloud Agent monitoring should be enabled or disabled on the node(s), defaults to enabled (disabled on rover)",
+			EnvVar: "OCI_AGENT_MONITORING",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-agent-management",
+			Usage:  "Specify if Oracle Cloud Agent management should be enabled or disabled on the node(s), defaults to enabled",
+			EnvVar: "OCI_AGENT_MANAGEMENT",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "oci-agent-plugin",
+			Usage:  "Specify desired state of an Oracle Cloud Agent plugin as <name>=enabled|disabled, e.g. bastion=enabled, can be repeated",
+			EnvVar: "OCI_AGENT_PLUGIN",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-bastion-id",
+			Usage:  "Specify OCID of a Bastion to reach the node(s) over SSH through, for nodes without a public IP",
+			EnvVar: "OCI_BASTION_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-bastion-session-type",
+			Usage:  "Specify type of bastion session: port-forwarding, or managed-ssh (requires the Bastion agent plugin)",
+			Value:  bastionSessionPortForwarding,
+			EnvVar: "OCI_BASTION_SESSION_TYPE",
+		},
+		mcnflag.IntFlag{
+			Name:   "oci-bastion-session-ttl",
+			Usage:  "Specify lifetime of bastion sessions in seconds (1800 to 10800)",
+			Value:  defaultBastionSessionTTL,
+			EnvVar: "OCI_BASTION_SESSION_TTL",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-jump-host",
+			Usage:  "Specify address of a jump host to reach the node(s) over SSH through",
+			EnvVar: "OCI_JUMP_HOST",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-jump-host-user",
+			Usage:  "Specify SSH user for the jump host",
+			Value:  defaultSSHUser,
+			EnvVar: "OCI_JUMP_HOST_USER",
+		},
+		mcnflag.IntFlag{
+			Name:   "oci-jump-host-port",
+			Usage:  "Specify SSH port of the jump host",
+			Value:  defaultSSHPort,
+			EnvVar: "OCI_JUMP_HOST_PORT",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-jump-host-key-path",
+			Usage:  "Specify path of the SSH private key for the jump host",
+			EnvVar: "OCI_JUMP_HOST_KEY_PATH",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-jump-host-key-contents",
+			Usage:  "Specify SSH private key contents for the jump host",
+			EnvVar: "OCI_JUMP_HOST_KEY_CONTENTS",
+		},
+		mcnflag.StringFlag{
+			Name:   "oci-jump-host-known-hosts",
+			Usage:  "Specify known_hosts entry (host key) of the jump host, used to verify it",
+			EnvVar: "OCI_JUMP_HOST_KNOWN_HOSTS",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-pin-host-keys",
+			Usage:  "Read the SSH host keys of the node(s) from the instance console, write them to known_hosts and check connections through the SSH tunnel against them",
+			EnvVar: "OCI_PIN_HOST_KEYS",
+		},
+		mcnflag.IntFlag{
+			Name:   "oci-host-key-timeout",
+			Usage:  "Specify how long to wait for the SSH host keys to show up on the instance console, in seconds",
+			Value:  defaultHostKeyTimeout,
+			EnvVar: "OCI_HOST_KEY_TIMEOUT",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-capture-console",
+			Usage:  "Save the serial console output of the node(s) to the machine directory after creation, even if it succeeds",
+			EnvVar: "OCI_CAPTURE_CONSOLE",
+		},
+		mcnflag.IntFlag{
+			Name:   "oci-lookup-cache-ttl",
+			Usage:  "Specify how long image and availability domain lookups are cached in the machine store, in seconds (0 disables the cache)",
+			Value:  defaultLookupCacheTTL,
+			EnvVar: "OCI_LOOKUP_CACHE_TTL",
+		},
+		mcnflag.BoolFlag{
+			Name:   "oci-bypass-lookup-cache",
+			Usage:  "Look up images and availability domains through the API instead of the cache, refreshing it",
+			EnvVar: "OCI_BYPASS_LOOKUP_CACHE",
+		},
 	}
 }
 
@@ -256,12 +846,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 func (d *Driver) GetIP() (string, error) {
 	log.Debug("oci.GetIP()")
 
+	if d.PreferIPv6 {
+		return d.GetIPv6()
+	}
+
 	if d.IPAddress == "" {
 		oci, err := d.initOCIClient()
 		if err != nil {
 			return "", err
 		}
-		ip, err := oci.GetInstanceIP(d.InstanceID, d.NodeCompartmentID)
+		ip, err := oci.GetInstanceIP(d.InstanceID, d.NodeCompartmentID, d.UsePrivateIP)
 		if err != nil {
 			return "", err
 		}
@@ -271,6 +865,25 @@ func (d *Driver) GetIP() (string, error) {
 	return d.IPAddress, nil
 }
 
+// GetIPv6 returns the IPv6 address of the host, if it has one
+func (d *Driver) GetIPv6() (string, error) {
+	log.Debug("oci.GetIPv6()")
+
+	if d.IPv6Address == "" {
+		oci, err := d.initOCIClient()
+		if err != nil {
+			return "", err
+		}
+		ip, err := oci.GetInstanceIPv6(d.InstanceID, d.NodeCompartmentID)
+		if err != nil {
+			return "", err
+		}
+		d.IPv6Address = ip
+	}
+
+	return d.IPv6Address, nil
+}
+
 // GetMachineName returns the name of the machine
 func (d *Driver) GetMachineName() string {
 	log.Debug("oci.GetMachineName()")
@@ -280,13 +893,41 @@ func (d *Driver) GetMachineName() string {
 // GetSSHHostname returns hostname for use with ssh
 func (d *Driver) GetSSHHostname() (string, error) {
 	log.Debug("oci.GetSSHHostname()")
-	return d.GetIP()
+
+	if d.usesSSHTunnel() {
+		if _, err := d.ensureSSHTunnel(); err != nil {
+			return "", err
+		}
+		return localhost, nil
+	}
+
+	if !d.UseFQDN {
+		return d.GetIP()
+	}
+
+	if d.FQDN == "" {
+		oci, err := d.initOCIClient()
+		if err != nil {
+			return "", err
+		}
+		fqdn, err := oci.GetInstanceFQDN(d.InstanceID, d.NodeCompartmentID)
+		if err != nil {
+			return "", err
+		}
+		d.FQDN = fqdn
+	}
+
+	return d.FQDN, nil
 }
 
 // GetSSHPort returns port for use with ssh
 func (d *Driver) GetSSHPort() (int, error) {
 	log.Debug("oci.GetSSHPort()")
 
+	if d.usesSSHTunnel() {
+		return d.ensureSSHTunnel()
+	}
+
 	return defaultSSHPort, nil
 }
 
@@ -298,7 +939,7 @@ func (d *Driver) GetSSHUsername() string {
 }
 
 // GetURL returns a Docker compatible host URL for connecting to this host
-// e.g. tcp://1.2.3.4:2376
+// e.g. tcp://1.2.3.4:2376 or tcp://[2001:db8::1]:2376
 func (d *Driver) GetURL() (string, error) {
 	log.Debug("oci.GetURL()")
 	ip, err := d.GetIP()
@@ -309,7 +950,7 @@ func (d *Driver) GetURL() (string, error) {
 		return "", nil
 	}
 
-	return fmt.Sprintf("tcp://%s:%d", ip, defaultDockerPort), nil
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, strconv.Itoa(defaultDockerPort))), nil
 }
 
 // GetState returns the state that the host is in (running, stopped, etc)
@@ -326,6 +967,15 @@ func (d *Driver) GetState() (state.State, error) {
 		return state.None, err
 	}
 
+	// The driver tags preemptible instances before terminating them, so an untagged one that
+	// is going away was preempted by OCI (or terminated outside of the driver).
+	if instance.PreemptibleInstanceConfig != nil && instance.FreeformTags[terminatedByDriverTag] == "" &&
+		(instance.LifecycleState == core.InstanceLifecycleStateTerminating ||
+			instance.LifecycleState == core.InstanceLifecycleStateTerminated) {
+		log.Warnf("preemptible instance %s was terminated by OCI (preempted), the node must be replaced", d.InstanceID)
+		return state.Error, nil
+	}
+
 	switch instance.LifecycleState {
 	case core.InstanceLifecycleStateRunning:
 		return state.Running, nil
@@ -352,7 +1002,7 @@ func (d *Driver) Kill() error {
 func (d *Driver) PreCreateCheck() error {
 	log.Debug("oci.PreCreateCheck()")
 	if d.IsRover {
-		return nil
+		return d.preCreateCheckRover()
 	}
 	// Check that the node image exists, which will also validate the credentials.
 	log.Infof("Verifying node image availability... ")
@@ -370,6 +1020,30 @@ func (d *Driver) PreCreateCheck() error {
 		return fmt.Errorf("could not retrieve node image ID from OCI")
 	}
 
+	if d.CapacityReservationID != "" {
+		log.Infof("Verifying capacity reservation... ")
+		err = oci.CheckCapacityReservation(d.CapacityReservationID, d.AvailabilityDomain, d.FaultDomain, d.Shape)
+		if err != nil {
+			if d.CapacityReservationFallback != capacityFallbackOnDemand {
+				return err
+			}
+			log.Warnf("%v, launching on regular capacity instead", err)
+			d.skipCapacityReservation = true
+		}
+	}
+
+	if d.hasPlatformConfig() {
+		log.Infof("Verifying shape platform configuration... ")
+		options, err := oci.GetShapePlatformConfigOptions(d.NodeCompartmentID, "", d.Shape)
+		if err != nil {
+			return err
+		}
+		err = d.validatePlatformConfig(options)
+		if err != nil {
+			return err
+		}
+	}
+
 	// TODO, verify VCN and subnet
 
 	return nil
@@ -384,7 +1058,39 @@ func (d *Driver) Remove() error {
 		return err
 	}
 
-	return oci.TerminateInstance(d.InstanceID)
+	if d.BastionSessionID != "" {
+		err = oci.DeleteBastionSession(d.BastionSessionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reserved public IPs that were passed in by OCID belong to the user, not the node.
+	if d.ReservedPublicIPID != "" && d.ReservedPublicIP == "" && !d.KeepReservedPublicIP {
+		err = oci.DeletePublicIP(d.ReservedPublicIPID)
+		if err != nil {
+			return err
+		}
+	} else if d.ReservedPublicIPID != "" {
+		// Release the IP before terminating the instance, so that a node recreated
+		// right away can take it over.
+		err = oci.UnassignPublicIP(d.ReservedPublicIPID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !d.ManageNSGs {
+		return oci.TerminateInstance(d.InstanceID)
+	}
+
+	// Wait for the node's VNIC to leave its NSGs before checking whether they are still in use.
+	err = oci.TerminateInstanceAndWait(d.InstanceID)
+	if err != nil {
+		return err
+	}
+
+	return oci.RemoveClusterNSGs(d.VCNCompartmentID, d.VCNID, d.NSGClusterName, d.NSGSourceCIDR)
 }
 
 // Restart a host. This may just call Stop(); Start() if the provider does not
@@ -431,8 +1137,14 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	if d.Region == "" {
 		return errors.New("no OCI oci-region specified (--oci-region)")
 	}
+	d.AllowUnknownRegion = flags.Bool("oci-allow-unknown-region")
+	if !flags.Bool("oci-is-rover") {
+		if err := validateRegion(d.Region, d.AllowUnknownRegion || flags.String("oci-realm-domain") != ""); err != nil {
+			return err
+		}
+	}
 	d.AvailabilityDomain = flags.String("oci-node-availability-domain")
-	if d.AvailabilityDomain == "" {
+	if d.AvailabilityDomain == "" && !flags.Bool("oci-is-rover") {
 		return errors.New("no OCI node availability domain specified (--oci-node-availability-domain)")
 	}
 	d.Shape = flags.String("oci-node-shape")
@@ -445,8 +1157,20 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	}
 	d.PrivateKeyPath = flags.String("oci-private-key-path")
 	d.PrivateKeyContents = flags.String("oci-private-key-contents")
-	if d.PrivateKeyPath == "" && d.PrivateKeyContents == "" {
-		return errors.New("no private key path or content specified (--oci-private-key-path || --oci-private-key-contents)")
+	d.PrivateKeyRef = flags.String("oci-private-key-ref")
+	if d.PrivateKeyPath == "" && d.PrivateKeyContents == "" && d.PrivateKeyRef == "" {
+		return errors.New("no private key path, content or reference specified (--oci-private-key-path || --oci-private-key-contents || --oci-private-key-ref)")
+	}
+	d.PrivateKeyPassphrase = flags.String("oci-private-key-passphrase")
+	d.PrivateKeyPassphraseRef = flags.String("oci-private-key-passphrase-ref")
+	if d.PrivateKeyRef != "" {
+		d.PrivateKeyContents = ""
+	}
+	if d.PrivateKeyPassphraseRef != "" {
+		d.PrivateKeyPassphrase = ""
+	}
+	if err := d.resolveCredentials(); err != nil {
+		return err
 	}
 	if d.PrivateKeyContents == "" && d.PrivateKeyPath != "" {
 		privateKeyBytes, err := ioutil.ReadFile(d.PrivateKeyPath)
@@ -458,16 +1182,304 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Image = flags.String("oci-node-image")
 	d.SSHUser = flags.String("oci-ssh-user")
 	d.SSHPort = flags.Int("oci-ssh-port")
+	d.SSHKeyType = strings.ToLower(flags.String("oci-ssh-key-type"))
+	if d.SSHKeyType == "" {
+		d.SSHKeyType = defaultSSHKeyType
+	}
+	if !validSSHKeyType(d.SSHKeyType) {
+		return fmt.Errorf("invalid SSH key type %q (--oci-ssh-key-type), must be one of %s", d.SSHKeyType, strings.Join(sshKeyTypes, ", "))
+	}
 	d.IsRover = flags.Bool("oci-is-rover")
 	d.RoverComputeEndpoint = flags.String("oci-rover-compute-endpoint")
 	d.RoverNetworkEndpoint = flags.String("oci-rover-network-endpoint")
 	d.RoverCertPath = flags.String("oci-rover-cert-path")
 	d.RoverCertContent = flags.String("oci-rover-cert-content")
+	d.RoverIdentityEndpoint = flags.String("oci-rover-identity-endpoint")
+	d.RoverAddress = flags.String("oci-rover-address")
+	if d.IsRover && d.RoverAddress != "" {
+		endpoint, err := roverEndpoint(d.RoverAddress)
+		if err != nil {
+			return err
+		}
+		if d.RoverComputeEndpoint == "" {
+			d.RoverComputeEndpoint = endpoint
+		}
+		if d.RoverNetworkEndpoint == "" {
+			d.RoverNetworkEndpoint = endpoint
+		}
+		if d.RoverIdentityEndpoint == "" {
+			d.RoverIdentityEndpoint = endpoint
+		}
+	}
+	if d.IsRover && (d.RoverComputeEndpoint == "" || d.RoverNetworkEndpoint == "") {
+		return errors.New("no rover endpoints specified (--oci-rover-address, or --oci-rover-compute-endpoint and --oci-rover-network-endpoint)")
+	}
 	if d.IsRover && d.RoverCertContent == "" && d.RoverCertPath != "" {
 		roverCertBytes, err := ioutil.ReadFile(d.RoverCertPath)
-		if err == nil {
-			log.Debug("inside inside inside")
-			d.RoverCertContent = string(roverCertBytes)
+		if err != nil {
+			return fmt.Errorf("could not read rover certificate (--oci-rover-cert-path): %v", err)
+		}
+		d.RoverCertContent = string(roverCertBytes)
+	}
+	if d.IsRover && strings.TrimSpace(d.RoverCertContent) == "" {
+		return errors.New("no rover certificate specified (--oci-rover-cert-path or --oci-rover-cert-content)")
+	}
+	d.ComputeEndpoint = flags.String("oci-compute-endpoint")
+	d.NetworkEndpoint = flags.String("oci-network-endpoint")
+	d.IdentityEndpoint = flags.String("oci-identity-endpoint")
+	d.BlockStorageEndpoint = flags.String("oci-block-storage-endpoint")
+	for flag, endpoint := range map[string]string{
+		"oci-compute-endpoint":       d.ComputeEndpoint,
+		"oci-network-endpoint":       d.NetworkEndpoint,
+		"oci-identity-endpoint":      d.IdentityEndpoint,
+		"oci-block-storage-endpoint": d.BlockStorageEndpoint,
+	} {
+		if endpoint != "" {
+			if err := validateEndpoint(endpoint, flag); err != nil {
+				return err
+			}
+		}
+	}
+	d.RealmDomain = strings.ToLower(strings.TrimPrefix(flags.String("oci-realm-domain"), "."))
+	if d.RealmDomain != "" {
+		if err := validateRealmDomain(d.RealmDomain, d.Region); err != nil {
+			return err
+		}
+	}
+	d.CABundlePath = flags.String("oci-ca-bundle-path")
+	d.CABundleContent = flags.String("oci-ca-bundle-content")
+	if d.CABundleContent == "" && d.CABundlePath != "" {
+		caBundleBytes, err := ioutil.ReadFile(d.CABundlePath)
+		if err != nil {
+			return fmt.Errorf("could not read CA bundle (--oci-ca-bundle-path): %v", err)
+		}
+		d.CABundleContent = string(caBundleBytes)
+	}
+	d.ProxyURL = flags.String("oci-proxy-url")
+	d.ProxyUsername = flags.String("oci-proxy-username")
+	d.ProxyPassword = flags.String("oci-proxy-password")
+	d.ProxyPasswordPath = flags.String("oci-proxy-password-path")
+	if d.ProxyPassword == "" && d.ProxyPasswordPath != "" {
+		proxyPasswordBytes, err := ioutil.ReadFile(d.ProxyPasswordPath)
+		if err != nil {
+			return fmt.Errorf("could not read proxy password (--oci-proxy-password-path): %v", err)
+		}
+		d.ProxyPassword = strings.TrimRight(string(proxyPasswordBytes), "\r\n")
+	}
+	if d.ProxyURL != "" && d.ProxyUsername != "" && d.ProxyPassword == "" {
+		return errors.New("a proxy user name (--oci-proxy-username) requires a password (--oci-proxy-password or --oci-proxy-password-path)")
+	}
+	d.NoProxy = flags.String("oci-no-proxy")
+	d.ClientCertPath = flags.String("oci-client-cert-path")
+	d.ClientCertContent = flags.String("oci-client-cert-content")
+	if d.ClientCertContent == "" && d.ClientCertPath != "" {
+		clientCertBytes, err := ioutil.ReadFile(d.ClientCertPath)
+		if err != nil {
+			return fmt.Errorf("could not read client certificate (--oci-client-cert-path): %v", err)
+		}
+		d.ClientCertContent = string(clientCertBytes)
+	}
+	d.ClientKeyPath = flags.String("oci-client-key-path")
+	d.ClientKeyContent = flags.String("oci-client-key-content")
+	if d.ClientKeyContent == "" && d.ClientKeyPath != "" {
+		clientKeyBytes, err := ioutil.ReadFile(d.ClientKeyPath)
+		if err != nil {
+			return fmt.Errorf("could not read client key (--oci-client-key-path): %v", err)
+		}
+		d.ClientKeyContent = string(clientKeyBytes)
+	}
+	if (d.ClientCertContent == "") != (d.ClientKeyContent == "") {
+		return errors.New("a client certificate (--oci-client-cert-path or --oci-client-cert-content) requires a client key (--oci-client-key-path or --oci-client-key-content), and vice versa")
+	}
+	if _, err := d.newTransport(); err != nil {
+		return err
+	}
+	d.AssignPublicIP = strings.ToLower(flags.String("oci-node-assign-public-ip"))
+	switch d.AssignPublicIP {
+	case "", assignPublicIPTrue, assignPublicIPFalse, assignPublicIPReserved:
+	default:
+		return fmt.Errorf("invalid value %q (--oci-node-assign-public-ip), must be true, false or reserved", d.AssignPublicIP)
+	}
+	d.ReservedPublicIP = flags.String("oci-node-reserved-public-ip-id")
+	d.PublicIPPool = flags.String("oci-node-public-ip-pool")
+	d.KeepReservedPublicIP = flags.Bool("oci-node-keep-reserved-public-ip")
+	if d.ReservedPublicIP != "" || d.PublicIPPool != "" {
+		if d.AssignPublicIP != "" && d.AssignPublicIP != assignPublicIPReserved {
+			return errors.New("a reserved public IP or public IP pool requires --oci-node-assign-public-ip reserved")
+		}
+		d.AssignPublicIP = assignPublicIPReserved
+	}
+	d.UsePrivateIP = flags.Bool("oci-use-private-ip")
+	d.NodePrivateIP = flags.String("oci-node-private-ip")
+	if d.NodePrivateIP != "" && net.ParseIP(d.NodePrivateIP) == nil {
+		return fmt.Errorf("invalid private IP address %q (--oci-node-private-ip)", d.NodePrivateIP)
+	}
+	d.AssignIPv6 = flags.Bool("oci-node-assign-ipv6")
+	d.NodeIPv6Address = flags.String("oci-node-ipv6-address")
+	d.PreferIPv6 = flags.Bool("oci-prefer-ipv6")
+	if d.NodeIPv6Address != "" {
+		if ip := net.ParseIP(d.NodeIPv6Address); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid IPv6 address %q (--oci-node-ipv6-address)", d.NodeIPv6Address)
+		}
+	}
+	d.AssignIPv6 = d.AssignIPv6 || d.NodeIPv6Address != "" || d.PreferIPv6
+	d.NodeHostnameLabel = strings.ToLower(flags.String("oci-node-hostname-label"))
+	if d.NodeHostnameLabel != "" && !validHostnameLabel(d.NodeHostnameLabel) {
+		return fmt.Errorf("invalid hostname label %q (--oci-node-hostname-label), must start with a letter and contain only letters, digits and hyphens (at most 63)", d.NodeHostnameLabel)
+	}
+	d.UseFQDN = flags.Bool("oci-use-fqdn")
+	d.DisplayNameTemplate = flags.String("oci-node-display-name-template")
+	if d.DisplayNameTemplate == "" {
+		d.DisplayNameTemplate = defaultDisplayNameTemplate
+	}
+	labels, err := parseLabels(flags.StringSlice("oci-node-labels"))
+	if err != nil {
+		return err
+	}
+	d.NodeLabels = labels
+	if _, err := renderDisplayName(d, strings.Repeat("x", displayNameSuffixLen)); err != nil {
+		return err
+	}
+	d.Preemptible = flags.Bool("oci-node-preemptible")
+	d.PreserveBootVolume = flags.Bool("oci-node-preserve-boot-volume-on-preemption")
+	if d.PreserveBootVolume && !d.Preemptible {
+		return errors.New("--oci-node-preserve-boot-volume-on-preemption requires --oci-node-preemptible")
+	}
+	d.FaultDomain = strings.ToUpper(flags.String("oci-node-fault-domain"))
+	d.CapacityReservationID = flags.String("oci-node-capacity-reservation-id")
+	d.CapacityReservationFallback = flags.String("oci-node-capacity-reservation-fallback")
+	switch d.CapacityReservationFallback {
+	case "":
+		d.CapacityReservationFallback = capacityFallbackFail
+	case capacityFallbackFail, capacityFallbackOnDemand:
+	default:
+		return fmt.Errorf("invalid capacity reservation fallback %q (--oci-node-capacity-reservation-fallback), must be fail or on-demand", d.CapacityReservationFallback)
+	}
+	d.DedicatedVMHostID = flags.String("oci-node-dedicated-vm-host-id")
+	d.ComputeClusterID = flags.String("oci-node-compute-cluster-id")
+	d.ClusterPlacementGroupID = flags.String("oci-node-cluster-placement-group-id")
+	d.SecureBoot = flags.Bool("oci-node-secure-boot")
+	d.MeasuredBoot = flags.Bool("oci-node-measured-boot")
+	d.TrustedPlatformModule = flags.Bool("oci-node-tpm")
+	d.MemoryEncryption = flags.Bool("oci-node-memory-encryption")
+	d.NetworkType = strings.ToUpper(flags.String("oci-node-network-type"))
+	if _, ok := core.GetMappingLaunchOptionsNetworkTypeEnum(d.NetworkType); d.NetworkType != "" && !ok {
+		return fmt.Errorf("invalid network type %q (--oci-node-network-type), must be one of %s", d.NetworkType, strings.Join(core.GetLaunchOptionsNetworkTypeEnumStringValues(), ", "))
+	}
+	d.BootVolumeType = strings.ToUpper(flags.String("oci-node-boot-volume-type"))
+	if _, ok := core.GetMappingLaunchOptionsBootVolumeTypeEnum(d.BootVolumeType); d.BootVolumeType != "" && !ok {
+		return fmt.Errorf("invalid boot volume type %q (--oci-node-boot-volume-type), must be one of %s", d.BootVolumeType, strings.Join(core.GetLaunchOptionsBootVolumeTypeEnumStringValues(), ", "))
+	}
+	d.BootVolumeSize = flags.Int("oci-node-boot-volume-size")
+	if d.BootVolumeSize != 0 && (d.BootVolumeSize < 50 || d.BootVolumeSize > 32768) {
+		return fmt.Errorf("invalid boot volume size %d (--oci-node-boot-volume-size), must be between 50 and 32768", d.BootVolumeSize)
+	}
+	d.AgentMonitoring = strings.ToLower(flags.String("oci-agent-monitoring"))
+	d.AgentManagement = strings.ToLower(flags.String("oci-agent-management"))
+	d.AgentPlugins = nil
+	for _, spec := range flags.StringSlice("oci-agent-plugin") {
+		plugin, err := parseAgentPlugin(spec)
+		if err != nil {
+			return err
+		}
+		d.AgentPlugins = append(d.AgentPlugins, plugin)
+	}
+	if _, err := d.buildAgentConfig(); err != nil {
+		return err
+	}
+	d.BastionID = flags.String("oci-bastion-id")
+	d.BastionSessionType = flags.String("oci-bastion-session-type")
+	switch d.BastionSessionType {
+	case "":
+		d.BastionSessionType = bastionSessionPortForwarding
+	case bastionSessionPortForwarding, bastionSessionManagedSSH:
+	default:
+		return fmt.Errorf("invalid bastion session type %q (--oci-bastion-session-type), must be port-forwarding or managed-ssh", d.BastionSessionType)
+	}
+	d.BastionSessionTTL = flags.Int("oci-bastion-session-ttl")
+	if d.BastionSessionTTL == 0 {
+		d.BastionSessionTTL = defaultBastionSessionTTL
+	}
+	if d.BastionSessionTTL < 1800 || d.BastionSessionTTL > 10800 {
+		return fmt.Errorf("invalid bastion session TTL %d (--oci-bastion-session-ttl), must be between 1800 and 10800 seconds", d.BastionSessionTTL)
+	}
+	d.JumpHost = flags.String("oci-jump-host")
+	d.JumpHostUser = flags.String("oci-jump-host-user")
+	d.JumpHostPort = flags.Int("oci-jump-host-port")
+	d.JumpHostKeyPath = flags.String("oci-jump-host-key-path")
+	d.JumpHostKeyContents = flags.String("oci-jump-host-key-contents")
+	d.JumpHostKnownHosts = flags.String("oci-jump-host-known-hosts")
+	if d.JumpHost != "" {
+		if d.BastionID != "" {
+			return errors.New("a jump host (--oci-jump-host) cannot be combined with a bastion (--oci-bastion-id)")
+		}
+		if d.JumpHostUser == "" {
+			d.JumpHostUser = defaultSSHUser
+		}
+		if d.JumpHostPort == 0 {
+			d.JumpHostPort = defaultSSHPort
+		}
+		if d.JumpHostKeyContents == "" && d.JumpHostKeyPath != "" {
+			jumpHostKeyBytes, err := ioutil.ReadFile(d.JumpHostKeyPath)
+			if err != nil {
+				return err
+			}
+			d.JumpHostKeyContents = string(jumpHostKeyBytes)
+		}
+		if d.JumpHostKeyContents == "" {
+			return errors.New("no jump host private key path or content specified (--oci-jump-host-key-path || --oci-jump-host-key-contents)")
+		}
+		if d.JumpHostKnownHosts == "" {
+			return errors.New("no jump host known_hosts entry specified (--oci-jump-host-known-hosts)")
+		}
+	}
+	d.PinHostKeys = flags.Bool("oci-pin-host-keys")
+	d.HostKeyTimeout = flags.Int("oci-host-key-timeout")
+	d.CaptureConsole = flags.Bool("oci-capture-console")
+	d.LookupCacheTTL = flags.Int("oci-lookup-cache-ttl")
+	if d.LookupCacheTTL < 0 {
+		return fmt.Errorf("invalid lookup cache TTL %d (--oci-lookup-cache-ttl), must not be negative", d.LookupCacheTTL)
+	}
+	d.BypassLookupCache = flags.Bool("oci-bypass-lookup-cache")
+	if d.HostKeyTimeout == 0 {
+		d.HostKeyTimeout = defaultHostKeyTimeout
+	}
+	if d.HostKeyTimeout < 0 {
+		return fmt.Errorf("invalid host key timeout %d (--oci-host-key-timeout), must be positive", d.HostKeyTimeout)
+	}
+	d.SecondaryVnics = nil
+	for _, spec := range flags.StringSlice("oci-node-secondary-vnic") {
+		vnic, err := parseSecondaryVnic(spec)
+		if err != nil {
+			return err
+		}
+		d.SecondaryVnics = append(d.SecondaryVnics, vnic)
+	}
+	d.SecondaryPrivateIPs = flags.StringSlice("oci-node-secondary-private-ip")
+	for _, address := range d.SecondaryPrivateIPs {
+		if address != autoPrivateIP && net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid secondary private IP address %q (--oci-node-secondary-private-ip)", address)
+		}
+	}
+	d.NodeNSGIDs = flags.StringSlice("oci-node-nsg-ids")
+	d.ManageNSGs = flags.Bool("oci-nsg-managed")
+	d.NSGClusterName = flags.String("oci-nsg-cluster-name")
+	d.NodeRoles = flags.StringSlice("oci-node-roles")
+	d.NSGSourceCIDR = flags.String("oci-nsg-source-cidr")
+	if d.ManageNSGs {
+		if d.NSGClusterName == "" {
+			return errors.New("no cluster name specified for managed network security groups (--oci-nsg-cluster-name)")
+		}
+		if d.NSGSourceCIDR == "" {
+			d.NSGSourceCIDR = anywhereCIDR
+		}
+		if len(d.NodeRoles) == 0 {
+			return errors.New("no node roles specified for managed network security groups (--oci-node-roles)")
+		}
+		for _, role := range d.NodeRoles {
+			if role != nodeRoleEtcd && role != nodeRoleControlPlane && role != nodeRoleWorker {
+				return fmt.Errorf("invalid node role %q (--oci-node-roles), must be one of %s", role, strings.Join(nodeRoles, ", "))
+			}
 		}
 	}
 	return nil
@@ -495,9 +1507,26 @@ func (d *Driver) Stop() error {
 	return oci.StopInstance(d.InstanceID)
 }
 
-// initOCIClient is a helper function that constructs a new
-// oci.Client based on config values.
+// initOCIClient is a helper function that returns the cached
+// oci.Client, constructing it from config values when they change.
 func (d *Driver) initOCIClient() (Client, error) {
+	d.clientLock.Lock()
+	defer d.clientLock.Unlock()
+
+	if err := d.resolveCredentials(); err != nil {
+		return Client{}, err
+	}
+	if d.hasCustomTransport() {
+		// Load them before the cache key is built from them.
+		if err := d.loadTransportSecrets(); err != nil {
+			return Client{}, err
+		}
+	}
+	key := d.clientConfigKey()
+	if d.client != nil && d.clientKey == key {
+		return *d.client, nil
+	}
+
 	configurationProvider := common.NewRawConfigurationProvider(
 		d.TenancyID,
 		d.UserID,
@@ -510,42 +1539,7 @@ func (d *Driver) initOCIClient() (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
+	d.client, d.clientKey = ociClient, key
 
 	return *ociClient, nil
 }
-
-func generatePrivateKey(bitSize int) (*rsa.PrivateKey, error) {
-	// Private Key generation
-	privateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
-	if err != nil {
-		return nil, err
-	}
-
-	// Validate RSA Private Key
-	err = privateKey.Validate()
-	if err != nil {
-		return nil, err
-	}
-
-	return privateKey, nil
-}
-
-func generatePublicKey(publicKey *rsa.PublicKey) ([]byte, error) {
-	publicRsaKey, err := ssh.NewPublicKey(publicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	return ssh.MarshalAuthorizedKey(publicRsaKey), nil
-}
-
-func encodePEM(privateKey *rsa.PrivateKey) []byte {
-
-	block := pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-
-	return pem.EncodeToMemory(&block)
-}
@@ -0,0 +1,104 @@
+package oci
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+const (
+	agentEnabled  = "enabled"
+	agentDisabled = "disabled"
+)
+
+// agentPluginAliases maps short names of common Oracle Cloud Agent plugins to their
+// names in the OCI API. Other plugins can be configured by their full name.
+var agentPluginAliases = map[string]string{
+	"bastion":                 "Bastion",
+	"os-management":           "OS Management Service Agent",
+	"vulnerability-scanning":  "Vulnerability Scanning",
+	"block-volume-management": "Block Volume Management",
+	"run-command":             "Compute Instance Run Command",
+	"monitoring":              "Compute Instance Monitoring",
+	"management-agent":        "Management Agent",
+	"custom-logs":             "Custom Logs Monitoring",
+}
+
+// AgentPlugin is the desired state of an Oracle Cloud Agent plugin.
+type AgentPlugin struct {
+	Name    string
+	Enabled bool
+}
+
+// parseAgentPlugin parses a --oci-agent-plugin value of the form <name>=enabled|disabled.
+func parseAgentPlugin(spec string) (AgentPlugin, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return AgentPlugin{}, fmt.Errorf("invalid agent plugin %q (--oci-agent-plugin), expected <name>=enabled|disabled", spec)
+	}
+
+	name := strings.TrimSpace(kv[0])
+	if alias, ok := agentPluginAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+	switch strings.ToLower(strings.TrimSpace(kv[1])) {
+	case agentEnabled:
+		return AgentPlugin{Name: name, Enabled: true}, nil
+	case agentDisabled:
+		return AgentPlugin{Name: name, Enabled: false}, nil
+	}
+
+	return AgentPlugin{}, fmt.Errorf("invalid state %q for agent plugin %s (--oci-agent-plugin), must be enabled or disabled", kv[1], name)
+}
+
+// parseAgentState parses an enabled/disabled flag value into whether the feature is disabled.
+// An empty value leaves the OCI default in place.
+func parseAgentState(flag, value string) (*bool, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return nil, nil
+	case agentEnabled:
+		return common.Bool(false), nil
+	case agentDisabled:
+		return common.Bool(true), nil
+	}
+	return nil, fmt.Errorf("invalid value %q (--%s), must be enabled or disabled", value, flag)
+}
+
+// buildAgentConfig returns the Oracle Cloud Agent configuration of the node, or nil to use the OCI defaults.
+func (d *Driver) buildAgentConfig() (*core.LaunchInstanceAgentConfigDetails, error) {
+	monitoringDisabled, err := parseAgentState("oci-agent-monitoring", d.AgentMonitoring)
+	if err != nil {
+		return nil, err
+	}
+	managementDisabled, err := parseAgentState("oci-agent-management", d.AgentManagement)
+	if err != nil {
+		return nil, err
+	}
+	// Monitoring is not available on rover devices.
+	if monitoringDisabled == nil && d.IsRover {
+		monitoringDisabled = common.Bool(true)
+	}
+	if monitoringDisabled == nil && managementDisabled == nil && len(d.AgentPlugins) == 0 {
+		return nil, nil
+	}
+
+	config := &core.LaunchInstanceAgentConfigDetails{
+		IsMonitoringDisabled: monitoringDisabled,
+		IsManagementDisabled: managementDisabled,
+	}
+	for _, plugin := range d.AgentPlugins {
+		state := core.InstanceAgentPluginConfigDetailsDesiredStateDisabled
+		if plugin.Enabled {
+			state = core.InstanceAgentPluginConfigDetailsDesiredStateEnabled
+		}
+		config.PluginsConfig = append(config.PluginsConfig, core.InstanceAgentPluginConfigDetails{
+			Name:         common.String(plugin.Name),
+			DesiredState: state,
+		})
+	}
+
+	return config, nil
+}
@@ -0,0 +1,95 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	bastionSessionManagedSSH     = "managed-ssh"
+	bastionSessionPortForwarding = "port-forwarding"
+	defaultBastionSessionTTL     = 10800
+	bastionSSHPort               = 22
+)
+
+// CreateBastionSession creates a session on a Bastion for SSH access to a compute instance
+// and waits for it to become active. It returns the OCID of the session.
+func (c *Client) CreateBastionSession(bastionID, sessionType, displayName, instanceID, targetIP, user string, port, ttl int, publicKey string) (string, error) {
+	var target bastion.CreateSessionTargetResourceDetails
+	if sessionType == bastionSessionManagedSSH {
+		target = bastion.CreateManagedSshSessionTargetResourceDetails{
+			TargetResourceId:                      &instanceID,
+			TargetResourceOperatingSystemUserName: &user,
+			TargetResourcePrivateIpAddress:        &targetIP,
+			TargetResourcePort:                    &port,
+		}
+	} else {
+		target = bastion.CreatePortForwardingSessionTargetResourceDetails{
+			TargetResourceId:               &instanceID,
+			TargetResourcePrivateIpAddress: &targetIP,
+			TargetResourcePort:             &port,
+		}
+	}
+
+	log.Infof("Creating %s session on bastion %s", sessionType, bastionID)
+	resp, err := c.bastionClient.CreateSession(context.Background(), bastion.CreateSessionRequest{
+		CreateSessionDetails: bastion.CreateSessionDetails{
+			BastionId:             &bastionID,
+			DisplayName:           &displayName,
+			TargetResourceDetails: target,
+			KeyDetails:            &bastion.PublicKeyDetails{PublicKeyContent: &publicKey},
+			SessionTtlInSeconds:   &ttl,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// wait until lifecycle status is Active (or Failed)
+	pollUntilActive := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(bastion.GetSessionResponse); ok {
+			return converted.LifecycleState != bastion.SessionLifecycleStateActive &&
+				converted.LifecycleState != bastion.SessionLifecycleStateFailed
+		}
+		return true
+	}
+
+	session, err := c.bastionClient.GetSession(context.Background(), bastion.GetSessionRequest{
+		SessionId:       resp.Id,
+		RequestMetadata: helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilActive),
+	})
+	if err != nil {
+		return "", err
+	}
+	if session.LifecycleState != bastion.SessionLifecycleStateActive {
+		return "", fmt.Errorf("bastion session %s is %s: %s", *resp.Id, session.LifecycleState, common.PointerString(session.LifecycleDetails))
+	}
+
+	return *resp.Id, nil
+}
+
+// IsBastionSessionActive reports whether a bastion session exists and is active.
+func (c *Client) IsBastionSessionActive(id string) (bool, error) {
+	session, err := c.bastionClient.GetSession(context.Background(), bastion.GetSessionRequest{SessionId: &id})
+	if err != nil {
+		if serviceErr, ok := common.IsServiceError(err); ok && serviceErr.GetHTTPStatusCode() == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return session.LifecycleState == bastion.SessionLifecycleStateActive, nil
+}
+
+// DeleteBastionSession deletes a bastion session by id (does not wait).
+func (c *Client) DeleteBastionSession(id string) error {
+	_, err := c.bastionClient.DeleteSession(context.Background(), bastion.DeleteSessionRequest{SessionId: &id})
+	if serviceErr, ok := common.IsServiceError(err); ok && serviceErr.GetHTTPStatusCode() == 404 {
+		return nil
+	}
+	return err
+}
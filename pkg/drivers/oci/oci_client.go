@@ -2,20 +2,19 @@ package oci
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"github.com/oracle/oci-go-sdk/example/helpers"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
 	"github.com/rancher/machine/libmachine/log"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/oracle/oci-go-sdk/common"
-	"github.com/oracle/oci-go-sdk/core"
-	"github.com/oracle/oci-go-sdk/identity"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/identity"
 )
 
 // Client defines / contains the OCI/Identity clients and operations.
@@ -24,7 +23,11 @@ type Client struct {
 	computeClient        core.ComputeClient
 	virtualNetworkClient core.VirtualNetworkClient
 	identityClient       identity.IdentityClient
+	bastionClient        bastion.BastionClient
+	blockstorageClient   core.BlockstorageClient
 	sleepDuration        time.Duration
+	skipIdentity         bool
+	lookupCache          *lookupCache
 	// TODO we could also include the retry settings here
 }
 
@@ -32,56 +35,71 @@ func newClient(configuration common.ConfigurationProvider, d *Driver) (*Client,
 
 	computeClient, err := core.NewComputeClientWithConfigurationProvider(configuration)
 	if err != nil {
-		log.Debugf("create new Compute client failed with err %v", err)
+		log.Debugf("create new Compute client failed with err %s", d.redact(err.Error()))
 		return nil, err
 	}
 	vNetClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(configuration)
 	if err != nil {
-		log.Debugf("create new VirtualNetwork client failed with err %v", err)
+		log.Debugf("create new VirtualNetwork client failed with err %s", d.redact(err.Error()))
 		return nil, err
 	}
-	if d.IsRover {
-		computeClient.Host = d.RoverComputeEndpoint
-		vNetClient.Host = d.RoverNetworkEndpoint
-		pool := x509.NewCertPool()
-		//pem, err := ioutil.ReadFile(d.RoverCertPath)
+	identityClient, err := identity.NewIdentityClientWithConfigurationProvider(configuration)
+	if err != nil {
+		log.Debugf("create new Identity client failed with err %s", d.redact(err.Error()))
+		return nil, err
+	}
+	bastionClient, err := bastion.NewBastionClientWithConfigurationProvider(configuration)
+	if err != nil {
+		log.Debugf("create new Bastion client failed with err %s", d.redact(err.Error()))
+		return nil, err
+	}
+	blockstorageClient, err := core.NewBlockstorageClientWithConfigurationProvider(configuration)
+	if err != nil {
+		log.Debugf("create new Blockstorage client failed with err %s", d.redact(err.Error()))
+		return nil, err
+	}
+	var transport *http.Transport
+	if d.hasCustomTransport() {
+		transport, err = d.newTransport()
 		if err != nil {
-			panic("can not read cert " + err.Error())
+			return nil, err
 		}
-		pool.AppendCertsFromPEM([]byte(d.RoverCertContent))
-		if h, ok := computeClient.HTTPClient.(*http.Client); ok {
-			tr := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
-			h.Transport = tr
-		} else {
-			panic("the client dispatcher is not of http.Client type. can not patch the tls config")
+	}
+	clients := map[string]*common.BaseClient{
+		serviceCompute:      &computeClient.BaseClient,
+		serviceNetwork:      &vNetClient.BaseClient,
+		serviceIdentity:     &identityClient.BaseClient,
+		serviceBlockStorage: &blockstorageClient.BaseClient,
+		serviceBastion:      &bastionClient.BaseClient,
+	}
+	for service, client := range clients {
+		if endpoint := d.endpoint(service); endpoint != "" {
+			client.Host = endpoint
 		}
-
-		if h, ok := vNetClient.HTTPClient.(*http.Client); ok {
-			//tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-			tr := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
-			h.Transport = tr
-		} else {
-			panic("the client dispatcher is not of http.Client type. can not patch the tls config")
+		if transport != nil {
+			if err := setTransport(client, transport); err != nil {
+				return nil, err
+			}
 		}
 	}
-	identityClient, err := identity.NewIdentityClientWithConfigurationProvider(configuration)
-	if err != nil {
-		log.Debugf("create new Identity client failed with err %v", err)
-		return nil, err
-	}
 	c := &Client{
 		configuration:        configuration,
 		computeClient:        computeClient,
 		virtualNetworkClient: vNetClient,
 		identityClient:       identityClient,
+		bastionClient:        bastionClient,
+		blockstorageClient:   blockstorageClient,
 		sleepDuration:        5,
+		// Without an identity endpoint, a rover device must not reach out to public OCI.
+		skipIdentity: d.IsRover && d.RoverIdentityEndpoint == "",
+		lookupCache:  d.newLookupCache(),
 	}
 	return c, nil
 }
 
 // CreateInstance creates a new compute instance.
 func (c *Client) CreateInstance(d *Driver, authorizedKeys string) (string, error) {
-	displayName := defaultNodeNamePfx + d.MachineName
+	displayName := d.DisplayName
 	availabilityDomain := d.AvailabilityDomain
 	compartmentID := d.NodeCompartmentID
 	nodeShape := d.Shape
@@ -99,8 +117,72 @@ func (c *Client) CreateInstance(d *Driver, authorizedKeys string) (string, error
 	if err != nil {
 		return "", err
 	}
+	request.CreateVnicDetails.NsgIds = append(append([]string{}, d.NodeNSGIDs...), d.ManagedNSGIDs...)
+	switch d.AssignPublicIP {
+	case assignPublicIPTrue:
+		request.CreateVnicDetails.AssignPublicIp = common.Bool(true)
+	case assignPublicIPFalse, assignPublicIPReserved:
+		// A reserved public IP is bound to the private IP once the instance is running.
+		request.CreateVnicDetails.AssignPublicIp = common.Bool(false)
+	}
+	if d.NodePrivateIP != "" {
+		request.CreateVnicDetails.PrivateIp = &d.NodePrivateIP
+	}
+	if d.HostnameLabel != "" {
+		request.CreateVnicDetails.HostnameLabel = &d.HostnameLabel
+	}
+	if d.AssignIPv6 {
+		request.CreateVnicDetails.AssignIpv6Ip = common.Bool(true)
+		if d.NodeIPv6Address != "" {
+			request.CreateVnicDetails.Ipv6AddressIpv6SubnetCidrPairDetails = []core.Ipv6AddressIpv6SubnetCidrPairDetails{
+				{Ipv6Address: &d.NodeIPv6Address},
+			}
+		}
+	}
+	if d.FaultDomain != "" {
+		request.FaultDomain = &d.FaultDomain
+	}
+	if source, ok := request.SourceDetails.(core.InstanceSourceViaImageDetails); ok && d.BootVolumeSize != 0 {
+		source.BootVolumeSizeInGBs = common.Int64(int64(d.BootVolumeSize))
+		request.SourceDetails = source
+	}
+	if d.CapacityReservationID != "" && !d.skipCapacityReservation {
+		request.CapacityReservationId = &d.CapacityReservationID
+	}
+	if d.DedicatedVMHostID != "" {
+		request.DedicatedVmHostId = &d.DedicatedVMHostID
+	}
+	if d.ComputeClusterID != "" {
+		request.ComputeClusterId = &d.ComputeClusterID
+	}
+	if d.ClusterPlacementGroupID != "" {
+		request.ClusterPlacementGroupId = &d.ClusterPlacementGroupID
+	}
+	if d.hasPlatformConfig() {
+		options, err := c.GetShapePlatformConfigOptions(compartmentID, *request.AvailabilityDomain, nodeShape)
+		if err != nil {
+			return "", err
+		}
+		request.PlatformConfig, err = d.buildPlatformConfig(options)
+		if err != nil {
+			return "", err
+		}
+	}
+	request.LaunchOptions = d.buildLaunchOptions()
+	request.AgentConfig, err = d.buildAgentConfig()
+	if err != nil {
+		return "", err
+	}
+	if d.Preemptible {
+		request.PreemptibleInstanceConfig = &core.PreemptibleInstanceConfigDetails{
+			PreemptionAction: core.TerminatePreemptionAction{
+				PreserveBootVolume: common.Bool(d.PreserveBootVolume),
+			},
+		}
+	}
+	request.Metadata["user_data"] = base64.StdEncoding.EncodeToString(createCloudInitScript(d))
 
-	log.Debug("request is ", request)
+	log.Debugf("request is %s", d.redactLaunchRequest(request))
 	createResp, err := c.computeClient.LaunchInstance(context.Background(), request)
 	if err != nil {
 		return "", err
@@ -130,25 +212,23 @@ func (c *Client) CreateInstance(d *Driver, authorizedKeys string) (string, error
 }
 
 func (c *Client) createReqForOCi(displayName string, availabilityDomain string, compartmentID string, nodeShape string, nodeImageName string, nodeSubnetID string, authorizedKeys string) (error, core.LaunchInstanceRequest) {
-	req := identity.ListAvailabilityDomainsRequest{}
-	req.CompartmentId = &compartmentID
-	ads, err := c.identityClient.ListAvailabilityDomains(context.Background(), req)
+	ads, err := c.listAvailabilityDomains(compartmentID)
 	if err != nil {
-		return nil, core.LaunchInstanceRequest{}
+		return err, core.LaunchInstanceRequest{}
 	}
 
 	// Just in case shortened or lower-case availability domain name was used
 	log.Debugf("Resolving availability domain from %s", availabilityDomain)
-	for _, ad := range ads.Items {
-		if strings.Contains(*ad.Name, strings.ToUpper(availabilityDomain)) {
-			log.Debugf("Availability domain %s", *ad.Name)
-			availabilityDomain = *ad.Name
+	for _, ad := range ads {
+		if strings.Contains(ad, strings.ToUpper(availabilityDomain)) {
+			log.Debugf("Availability domain %s", ad)
+			availabilityDomain = ad
 		}
 	}
 
 	imageID, err := c.getImageID(compartmentID, nodeImageName)
 	if err != nil {
-		return nil, core.LaunchInstanceRequest{}
+		return err, core.LaunchInstanceRequest{}
 	}
 	// Create the launch compute instance request
 	request := core.LaunchInstanceRequest{
@@ -162,7 +242,6 @@ func (c *Client) createReqForOCi(displayName string, availabilityDomain string,
 			DisplayName: &displayName,
 			Metadata: map[string]string{
 				"ssh_authorized_keys": authorizedKeys,
-				"user_data":           base64.StdEncoding.EncodeToString(createCloudInitScript()),
 			},
 			SourceDetails: core.InstanceSourceViaImageDetails{
 				ImageId: imageID,
@@ -173,40 +252,63 @@ func (c *Client) createReqForOCi(displayName string, availabilityDomain string,
 }
 
 func (c *Client) createReqForRover(displayName string, availabilityDomain string, compartmentID string, nodeShape string, nodeImageName string, nodeSubnetID string, authorizedKeys string) (error, core.LaunchInstanceRequest) {
+	availabilityDomain, err := c.roverAvailabilityDomain(availabilityDomain, compartmentID, nodeSubnetID)
+	if err != nil {
+		return err, core.LaunchInstanceRequest{}
+	}
 	imageID, err := c.getImageID(compartmentID, nodeImageName)
 	if err != nil {
-		log.Error(err)
-		log.Debug("inside error bhau", err)
-		return nil, core.LaunchInstanceRequest{}
+		return err, core.LaunchInstanceRequest{}
 	}
-	// Create the launch compute instance request
+	// Create the launch compute instance request; fault domain, boot volume size and
+	// public IP assignment default to what rover devices expect unless configured.
 	request := core.LaunchInstanceRequest{
 		LaunchInstanceDetails: core.LaunchInstanceDetails{
-			AvailabilityDomain: common.String("OREI-1-AD-1"),
+			AvailabilityDomain: &availabilityDomain,
 			CompartmentId:      &compartmentID,
 			Shape:              &nodeShape,
 			CreateVnicDetails: &core.CreateVnicDetails{
 				SubnetId:       &nodeSubnetID,
 				AssignPublicIp: common.Bool(true),
 			},
-			FaultDomain: common.String("FAULT-DOMAIN-1"),
+			FaultDomain: common.String(roverDefaultFaultDomain),
 			DisplayName: &displayName,
 			Metadata: map[string]string{
 				"ssh_authorized_keys": authorizedKeys,
-				"user_data":           base64.StdEncoding.EncodeToString(createCloudInitScript()),
 			},
 			SourceDetails: core.InstanceSourceViaImageDetails{
 				ImageId:             imageID,
-				BootVolumeSizeInGBs: common.Int64(50),
-			},
-			AgentConfig: &core.LaunchInstanceAgentConfigDetails{
-				IsMonitoringDisabled: common.Bool(true),
+				BootVolumeSizeInGBs: common.Int64(roverDefaultBootVolumeSize),
 			},
 		},
 	}
 	return err, request
 }
 
+// listAvailabilityDomains returns the names of the availability domains of a compartment.
+func (c *Client) listAvailabilityDomains(compartmentID string) ([]string, error) {
+	cacheKey := lookupCacheKey(lookupKindAvailability, c.identityClient.Host, compartmentID)
+	if names, ok := c.lookupCache.get(cacheKey); ok {
+		return strings.Split(names, ","), nil
+	}
+
+	ads, err := c.identityClient.ListAvailabilityDomains(context.Background(), identity.ListAvailabilityDomainsRequest{
+		CompartmentId: &compartmentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, ad := range ads.Items {
+		names = append(names, *ad.Name)
+	}
+	if len(names) > 0 {
+		c.lookupCache.put(cacheKey, strings.Join(names, ","))
+	}
+
+	return names, nil
+}
+
 // GetInstance gets a compute instance by id.
 func (c *Client) GetInstance(id string) (core.Instance, error) {
 	instanceResp, err := c.computeClient.GetInstance(context.Background(), core.GetInstanceRequest{InstanceId: &id})
@@ -216,9 +318,102 @@ func (c *Client) GetInstance(id string) (core.Instance, error) {
 	return instanceResp.Instance, err
 }
 
+// SetBootVolumeDisplayName sets the display name of the boot volume of a compute instance.
+func (c *Client) SetBootVolumeDisplayName(id, displayName string) error {
+	instance, err := c.GetInstance(id)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := c.computeClient.ListBootVolumeAttachments(context.Background(), core.ListBootVolumeAttachmentsRequest{
+		AvailabilityDomain: instance.AvailabilityDomain,
+		CompartmentId:      instance.CompartmentId,
+		InstanceId:         &id,
+	})
+	if err != nil {
+		return err
+	}
+	if len(attachments.Items) == 0 {
+		return errors.New("instance does not have a boot volume attached")
+	}
+
+	_, err = c.blockstorageClient.UpdateBootVolume(context.Background(), core.UpdateBootVolumeRequest{
+		BootVolumeId: attachments.Items[0].BootVolumeId,
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+			DisplayName: &displayName,
+		},
+	})
+	return err
+}
+
 // TerminateInstance terminates a compute instance by id (does not wait).
 func (c *Client) TerminateInstance(id string) error {
-	_, err := c.computeClient.TerminateInstance(context.Background(), core.TerminateInstanceRequest{InstanceId: &id})
+	err := c.tagTerminatedByDriver(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.computeClient.TerminateInstance(context.Background(), core.TerminateInstanceRequest{InstanceId: &id})
+	return err
+}
+
+// tagTerminatedByDriver tags a preemptible instance before the driver terminates it, so
+// that GetState can tell it apart from an instance that was preempted. Instances that are
+// already gone or being terminated, e.g. because they were preempted, are left untagged.
+func (c *Client) tagTerminatedByDriver(id string) error {
+	instance, err := c.GetInstance(id)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if instance.PreemptibleInstanceConfig == nil || instance.FreeformTags[terminatedByDriverTag] != "" {
+		return nil
+	}
+	if instance.LifecycleState == core.InstanceLifecycleStateTerminating ||
+		instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+		return nil
+	}
+
+	tags := map[string]string{terminatedByDriverTag: "true"}
+	for k, v := range instance.FreeformTags {
+		tags[k] = v
+	}
+	_, err = c.computeClient.UpdateInstance(context.Background(), core.UpdateInstanceRequest{
+		InstanceId: &id,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: tags,
+		},
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// TerminateInstanceAndWait terminates a compute instance by id and waits for it to reach the Terminated state.
+func (c *Client) TerminateInstanceAndWait(id string) error {
+	err := c.TerminateInstance(id)
+	if err != nil {
+		return err
+	}
+
+	// wait until lifecycle status is Terminated
+	pollUntilTerminated := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(core.GetInstanceResponse); ok {
+			return converted.LifecycleState != core.InstanceLifecycleStateTerminated
+		}
+		return true
+	}
+
+	pollingGetRequest := core.GetInstanceRequest{
+		InstanceId:      &id,
+		RequestMetadata: helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilTerminated),
+	}
+
+	_, err = c.computeClient.GetInstance(context.Background(), pollingGetRequest)
+
 	return err
 }
 
@@ -291,34 +486,66 @@ func (c *Client) RestartInstance(id string) error {
 	return c.StartInstance(id)
 }
 
-// GetInstanceIP returns the public IP (or private IP if that is what it has).
-func (c *Client) GetInstanceIP(id, compartmentID string) (string, error) {
-	vnics, err := c.computeClient.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{
-		InstanceId:    &id,
-		CompartmentId: &compartmentID,
-	})
+// GetInstanceIP returns the public IP (or private IP if that is what it has, or privateIP is set).
+func (c *Client) GetInstanceIP(id, compartmentID string, privateIP bool) (string, error) {
+	vnic, err := c.getPrimaryVnic(id, compartmentID)
 	if err != nil {
 		return "", err
 	}
 
-	if len(vnics.Items) == 0 {
-		return "", errors.New("instance does not have any configured VNICs")
+	if vnic.PublicIp == nil || privateIP {
+		return *vnic.PrivateIp, nil
 	}
 
-	vnic, err := c.virtualNetworkClient.GetVnic(context.Background(), core.GetVnicRequest{VnicId: vnics.Items[0].VnicId})
+	return *vnic.PublicIp, nil
+}
+
+// GetInstanceIPv6 returns the first IPv6 address of the primary VNIC of a compute instance.
+func (c *Client) GetInstanceIPv6(id, compartmentID string) (string, error) {
+	vnic, err := c.getPrimaryVnic(id, compartmentID)
 	if err != nil {
 		return "", err
 	}
 
-	if vnic.PublicIp == nil {
-		return *vnic.PrivateIp, nil
+	if len(vnic.Ipv6Addresses) == 0 {
+		return "", errors.New("instance does not have an IPv6 address")
 	}
 
-	return *vnic.PublicIp, nil
+	return vnic.Ipv6Addresses[0], nil
+}
+
+// getPrimaryVnic returns the primary VNIC of a compute instance.
+func (c *Client) getPrimaryVnic(id, compartmentID string) (core.Vnic, error) {
+	vnics, err := c.computeClient.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{
+		InstanceId:    &id,
+		CompartmentId: &compartmentID,
+	})
+	if err != nil {
+		return core.Vnic{}, err
+	}
+
+	if len(vnics.Items) == 0 {
+		return core.Vnic{}, errors.New("instance does not have any configured VNICs")
+	}
+
+	for _, attachment := range vnics.Items {
+		if attachment.LifecycleState != core.VnicAttachmentLifecycleStateAttached {
+			continue
+		}
+		vnic, err := c.virtualNetworkClient.GetVnic(context.Background(), core.GetVnicRequest{VnicId: attachment.VnicId})
+		if err != nil {
+			return core.Vnic{}, err
+		}
+		if vnic.IsPrimary != nil && *vnic.IsPrimary {
+			return vnic.Vnic, nil
+		}
+	}
+
+	return core.Vnic{}, errors.New("instance does not have an attached primary VNIC")
 }
 
 // Create the cloud init script
-func createCloudInitScript() []byte {
+func createCloudInitScript(d *Driver) []byte {
 	cloudInit := []string{
 		"#!/bin/sh",
 		"#echo \"Disabling OS firewall...\"",
@@ -340,6 +567,28 @@ func createCloudInitScript() []byte {
 		"# Elasticsearch requirement",
 		"sudo sysctl -w vm.max_map_count=262144",
 	}
+	if d.AssignIPv6 {
+		cloudInit = append(cloudInit,
+			"",
+			"echo \"Enabling IPv6...\"",
+			"cat <<EOF | sudo tee /etc/sysctl.d/90-ipv6.conf",
+			"net.ipv6.conf.all.disable_ipv6 = 0",
+			"net.ipv6.conf.default.disable_ipv6 = 0",
+			"net.ipv6.conf.all.forwarding = 1",
+			"EOF",
+			"sudo sysctl --system",
+			"sudo dhclient -6 $(/usr/sbin/ip -o -4 route show to default | awk '{print $5}')",
+		)
+	}
+	if len(d.SecondaryVnics) > 0 || len(d.SecondaryPrivateIPs) > 0 {
+		// ocid configures secondary VNICs and private IPs in the OS as they get attached
+		cloudInit = append(cloudInit,
+			"",
+			"echo \"Configuring secondary VNICs and private IPs...\"",
+			"sudo yum install -y oci-utils",
+			"sudo systemctl enable --now ocid.service",
+		)
+	}
 	return []byte(strings.Join(cloudInit, "\n"))
 }
 
@@ -349,6 +598,10 @@ func (c *Client) getImageID(compartmentID, nodeImageName string) (*string, error
 	if nodeImageName == "" || compartmentID == "" {
 		return nil, errors.New("cannot retrieve image ID without a compartment and image name")
 	}
+	cacheKey := lookupCacheKey(lookupKindImage, c.computeClient.Host, compartmentID, strings.ToLower(nodeImageName))
+	if imageID, ok := c.lookupCache.get(cacheKey); ok {
+		return &imageID, nil
+	}
 	// Get list of images
 	log.Debugf("Resolving image ID from %s", nodeImageName)
 	var page *string
@@ -374,14 +627,15 @@ func (c *Client) getImageID(compartmentID, nodeImageName string) (*string, error
 		}
 		//request := core.ListImagesRequest{CompartmentId: common.String(compartmentID)}
 		r, err := c.computeClient.ListImages(context.Background(), request)
-		log.Infof("r is", r)
 		if err != nil {
 			return nil, err
 		}
+		log.Debugf("Listed %d images", len(r.Items))
 		// Loop through the items to find an image to use.  The list is sorted by time created in descending order
 		for _, image := range r.Items {
 			if strings.EqualFold(*image.DisplayName, nodeImageName) {
 				log.Infof("Provisioning node using image %s", *image.DisplayName)
+				c.lookupCache.put(cacheKey, *image.Id)
 				return image.Id, nil
 			}
 		}
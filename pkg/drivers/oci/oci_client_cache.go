@@ -0,0 +1,21 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// clientConfigKey returns a digest of the settings the OCI clients are built from, which
+// changes whenever the clients need to be rebuilt.
+func (d *Driver) clientConfigKey() string {
+	config, _ := json.Marshal([]interface{}{
+		d.TenancyID, d.UserID, d.Region, d.Fingerprint, d.PrivateKeyContents, d.PrivateKeyPassphrase,
+		d.IsRover, d.RoverComputeEndpoint, d.RoverNetworkEndpoint, d.RoverIdentityEndpoint, d.RoverCertContent,
+		d.ComputeEndpoint, d.NetworkEndpoint, d.IdentityEndpoint, d.BlockStorageEndpoint, d.RealmDomain,
+		d.CABundleContent, d.ProxyURL, d.ProxyUsername, d.ProxyPassword, d.NoProxy,
+		d.ClientCertContent, d.ClientKeyContent, d.StorePath, d.LookupCacheTTL, d.BypassLookupCache,
+	})
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	// consoleHistoryMaxLength is the largest amount of console output, in bytes, the API returns at once.
+	consoleHistoryMaxLength = 1024 * 1024
+	consoleLogFile          = "console.log"
+	consoleTailLines        = 40
+)
+
+// saveConsoleLog captures the serial console output of the node and writes it to the
+// machine directory. It returns the captured output.
+func (d *Driver) saveConsoleLog(oci Client) (string, error) {
+	console, err := oci.GetConsoleHistory(d.InstanceID)
+	if err != nil {
+		return "", err
+	}
+	path := d.ResolveStorePath(consoleLogFile)
+	if err := ioutil.WriteFile(path, []byte(console), 0600); err != nil {
+		return "", err
+	}
+	log.Infof("Saved console history of instance %s to %s", d.InstanceID, path)
+
+	return console, nil
+}
+
+// withConsoleLog saves the serial console output of the node after a failure and adds
+// its last lines to the error, as boot and cloud-init problems only show up there.
+func (d *Driver) withConsoleLog(oci Client, err error) error {
+	console, consoleErr := d.saveConsoleLog(oci)
+	if consoleErr != nil {
+		log.Warnf("Could not capture console history of instance %s: %v", d.InstanceID, consoleErr)
+		return err
+	}
+
+	return fmt.Errorf("%v\nlast lines of the console of instance %s (full output in %s):\n%s",
+		err, d.InstanceID, d.ResolveStorePath(consoleLogFile), consoleTail(console, consoleTailLines))
+}
+
+// consoleTail returns the last n lines of the console output.
+func consoleTail(console string, n int) string {
+	lines := strings.Split(strings.TrimRight(console, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GetConsoleHistory captures the serial console output of a compute instance and
+// returns its content. The captured history is deleted afterwards.
+func (c *Client) GetConsoleHistory(instanceID string) (string, error) {
+	resp, err := c.computeClient.CaptureConsoleHistory(context.Background(), core.CaptureConsoleHistoryRequest{
+		CaptureConsoleHistoryDetails: core.CaptureConsoleHistoryDetails{
+			InstanceId: &instanceID,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer c.computeClient.DeleteConsoleHistory(context.Background(), core.DeleteConsoleHistoryRequest{
+		InstanceConsoleHistoryId: resp.Id,
+	})
+
+	// wait until lifecycle status is Succeeded (or Failed)
+	pollUntilCaptured := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(core.GetConsoleHistoryResponse); ok {
+			return converted.LifecycleState != core.ConsoleHistoryLifecycleStateSucceeded &&
+				converted.LifecycleState != core.ConsoleHistoryLifecycleStateFailed
+		}
+		return true
+	}
+
+	history, err := c.computeClient.GetConsoleHistory(context.Background(), core.GetConsoleHistoryRequest{
+		InstanceConsoleHistoryId: resp.Id,
+		RequestMetadata:          helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilCaptured),
+	})
+	if err != nil {
+		return "", err
+	}
+	if history.LifecycleState != core.ConsoleHistoryLifecycleStateSucceeded {
+		return "", fmt.Errorf("could not capture console history of instance %s: %s", instanceID, history.LifecycleState)
+	}
+
+	content, err := c.computeClient.GetConsoleHistoryContent(context.Background(), core.GetConsoleHistoryContentRequest{
+		InstanceConsoleHistoryId: resp.Id,
+		Length:                   common.Int(consoleHistoryMaxLength),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if content.Value == nil {
+		return "", nil
+	}
+
+	return *content.Value, nil
+}
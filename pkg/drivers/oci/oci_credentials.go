@@ -0,0 +1,252 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+	"github.com/oracle/oci-go-sdk/v65/secrets"
+)
+
+const (
+	credentialRefFile  = "file:"
+	credentialRefEnv   = "env:"
+	credentialRefVault = "vault:"
+	vaultSecretOCIDPfx = "ocid1.vaultsecret."
+)
+
+// resolveCredentialRef returns the credential a reference points to: a file (file:<path>),
+// an environment variable (env:<name>) or the current version of an OCI Vault secret
+// (vault:<OCID> or just the OCID), read with the instance principal of the host.
+func resolveCredentialRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, credentialRefFile):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(ref, credentialRefFile))
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	case strings.HasPrefix(ref, credentialRefEnv):
+		name := strings.TrimPrefix(ref, credentialRefEnv)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, credentialRefVault), strings.HasPrefix(ref, vaultSecretOCIDPfx):
+		return readVaultSecret(strings.TrimPrefix(ref, credentialRefVault))
+	}
+	return "", fmt.Errorf("invalid credential reference %q, must be file:<path>, env:<name> or vault:<secret OCID>", ref)
+}
+
+// readVaultSecret reads the current version of an OCI Vault secret. It always uses the
+// instance principal, since the secret may be the API key the driver is configured with.
+func readVaultSecret(secretID string) (string, error) {
+	configurationProvider, err := auth.InstancePrincipalConfigurationProvider()
+	if err != nil {
+		return "", fmt.Errorf("cannot read vault secrets without an instance principal: %v", err)
+	}
+	client, err := secrets.NewSecretsClientWithConfigurationProvider(configurationProvider)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.GetSecretBundle(context.Background(), secrets.GetSecretBundleRequest{
+		SecretId: &secretID,
+		Stage:    secrets.GetSecretBundleStageCurrent,
+	})
+	if err != nil {
+		return "", err
+	}
+	content, ok := resp.SecretBundleContent.(secrets.Base64SecretBundleContentDetails)
+	if !ok || content.Content == nil {
+		return "", fmt.Errorf("vault secret %s has no base64 content", secretID)
+	}
+	value, err := base64.StdEncoding.DecodeString(*content.Content)
+	if err != nil {
+		return "", fmt.Errorf("could not decode vault secret %s: %v", secretID, err)
+	}
+	return string(value), nil
+}
+
+// resolveCredentials resolves the credentials that are persisted as references, as the
+// machine store only holds the references. Each reference is resolved once per driver
+// process; the value is kept for later calls.
+func (d *Driver) resolveCredentials() error {
+	var err error
+	if d.PrivateKeyRef != "" && d.PrivateKeyContents == "" {
+		d.PrivateKeyContents, err = resolveCredentialRef(d.PrivateKeyRef)
+		if err != nil {
+			return fmt.Errorf("could not resolve private key reference: %v", err)
+		}
+	}
+	if d.PrivateKeyPassphraseRef != "" && d.PrivateKeyPassphrase == "" {
+		d.PrivateKeyPassphrase, err = resolveCredentialRef(d.PrivateKeyPassphraseRef)
+		if err != nil {
+			return fmt.Errorf("could not resolve private key passphrase reference: %v", err)
+		}
+	}
+	return nil
+}
+
+// reloadSecret re-reads a secret that is never persisted, from its file or else from the
+// environment variable of its flag, unless it is already set.
+func reloadSecret(value *string, path, envVar, name, flag string) error {
+	if *value != "" {
+		return nil
+	}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read %s (--%s-path): %v", name, flag, err)
+		}
+		*value = string(content)
+	} else {
+		*value = os.Getenv(envVar)
+	}
+	if *value == "" {
+		return fmt.Errorf("the %s is not stored with the machine, pass it with --%s-path or set %s", name, flag, envVar)
+	}
+	return nil
+}
+
+// loadTransportSecrets re-reads the proxy password and the client key, which API traffic
+// needs when a proxy with a user name or a client certificate is configured.
+func (d *Driver) loadTransportSecrets() error {
+	if d.ProxyURL != "" && d.ProxyUsername != "" {
+		err := reloadSecret(&d.ProxyPassword, d.ProxyPasswordPath, "OCI_PROXY_PASSWORD", "proxy password", "oci-proxy-password")
+		if err != nil {
+			return err
+		}
+		d.ProxyPassword = strings.TrimRight(d.ProxyPassword, "\r\n")
+	}
+	if d.ClientCertContent != "" {
+		return reloadSecret(&d.ClientKeyContent, d.ClientKeyPath, "OCI_CLIENT_KEY_CONTENT", "client key", "oci-client-key")
+	}
+	return nil
+}
+
+// MarshalJSON serializes the driver for the machine store, leaving out the credentials
+// that are persisted as references. The proxy password, client key and jump host key are
+// always left out by their struct tags.
+func (d *Driver) MarshalJSON() ([]byte, error) {
+	type plainDriver Driver
+	data, err := json.Marshal((*plainDriver)(d))
+	if err != nil || (d.PrivateKeyRef == "" && d.PrivateKeyPassphraseRef == "") {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if d.PrivateKeyRef != "" {
+		delete(fields, "PrivateKeyContents")
+	}
+	if d.PrivateKeyPassphraseRef != "" {
+		delete(fields, "PrivateKeyPassphrase")
+	}
+	return json.Marshal(fields)
+}
+
+// MigrateMachineCredentials rewrites the stored config of an OCI machine so that it holds
+// references instead of the private key and passphrase. The references must resolve to the
+// stored credentials, so a migrated machine keeps working. It reports whether the machine
+// was migrated; machines of other drivers are skipped.
+func MigrateMachineCredentials(configPath, privateKeyRef, passphraseRef string) (bool, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return false, err
+	}
+	var host map[string]json.RawMessage
+	if err := json.Unmarshal(data, &host); err != nil {
+		return false, fmt.Errorf("could not parse %s: %v", configPath, err)
+	}
+	var driverName string
+	if err := json.Unmarshal(host["DriverName"], &driverName); err != nil || driverName != "oci" {
+		return false, nil
+	}
+	var driver map[string]interface{}
+	if err := json.Unmarshal(host["Driver"], &driver); err != nil {
+		return false, fmt.Errorf("could not parse driver config in %s: %v", configPath, err)
+	}
+
+	for _, c := range []struct{ ref, refField, valueField string }{
+		{privateKeyRef, "PrivateKeyRef", "PrivateKeyContents"},
+		{passphraseRef, "PrivateKeyPassphraseRef", "PrivateKeyPassphrase"},
+	} {
+		if c.ref == "" {
+			continue
+		}
+		value, err := resolveCredentialRef(c.ref)
+		if err != nil {
+			return false, err
+		}
+		if stored, _ := driver[c.valueField].(string); stored != "" && stored != value {
+			return false, fmt.Errorf("%s of %s does not match the credential referenced by %s", c.valueField, configPath, c.ref)
+		}
+		driver[c.refField] = c.ref
+		delete(driver, c.valueField)
+	}
+
+	host["Driver"], err = json.Marshal(driver)
+	if err != nil {
+		return false, err
+	}
+	data, err = json.MarshalIndent(host, "", "    ")
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the config atomically so a failure never leaves a truncated config behind.
+	tmp, err := ioutil.TempFile(filepath.Dir(configPath), filepath.Base(configPath)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), configPath)
+}
+
+// MigrateStoreCredentials migrates the stored config of every OCI machine in a store (or
+// only the named machine) with MigrateMachineCredentials, and returns the migrated machines.
+func MigrateStoreCredentials(storePath, machineName, privateKeyRef, passphraseRef string) ([]string, error) {
+	if privateKeyRef == "" && passphraseRef == "" {
+		return nil, errors.New("no credential reference to migrate to")
+	}
+	pattern := filepath.Join(storePath, "machines", "*", "config.json")
+	if machineName != "" {
+		pattern = filepath.Join(storePath, "machines", machineName, "config.json")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []string
+	for _, path := range paths {
+		ok, err := MigrateMachineCredentials(path, privateKeyRef, passphraseRef)
+		if err != nil {
+			return migrated, err
+		}
+		if ok {
+			migrated = append(migrated, filepath.Base(filepath.Dir(path)))
+		}
+	}
+	return migrated, nil
+}
@@ -0,0 +1,85 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const (
+	defaultDisplayNameTemplate = defaultNodeNamePfx + "{{.MachineName}}"
+	maxDisplayNameLen          = 255
+	displayNameSuffixLen       = 5
+	displayNameSuffixChars     = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// displayNameData is the data available to --oci-node-display-name-template.
+type displayNameData struct {
+	MachineName        string
+	Labels             map[string]string
+	Region             string
+	AvailabilityDomain string
+	Suffix             string
+}
+
+// renderDisplayName renders the display name template of the node and validates the result.
+func renderDisplayName(d *Driver, suffix string) (string, error) {
+	tmpl, err := template.New("display-name").Option("missingkey=error").Parse(d.DisplayNameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid display name template (--oci-node-display-name-template): %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, displayNameData{
+		MachineName:        d.MachineName,
+		Labels:             d.NodeLabels,
+		Region:             d.Region,
+		AvailabilityDomain: d.AvailabilityDomain,
+		Suffix:             suffix,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not render display name template (--oci-node-display-name-template): %v", err)
+	}
+
+	name := strings.TrimSpace(buf.String())
+	if name == "" || len(name) > maxDisplayNameLen {
+		return "", fmt.Errorf("display name %q must be between 1 and %d characters long", name, maxDisplayNameLen)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("display name %q must not contain control characters", name)
+		}
+	}
+
+	return name, nil
+}
+
+// randomSuffix returns a short random string of lower case letters and digits.
+func randomSuffix() (string, error) {
+	suffix := make([]byte, displayNameSuffixLen)
+	for i := range suffix {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(displayNameSuffixChars))))
+		if err != nil {
+			return "", err
+		}
+		suffix[i] = displayNameSuffixChars[n.Int64()]
+	}
+	return string(suffix), nil
+}
+
+// parseLabels parses key=value pairs into a map.
+func parseLabels(pairs []string) (map[string]string, error) {
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q (--oci-node-labels), expected key=value", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
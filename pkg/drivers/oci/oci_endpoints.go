@@ -0,0 +1,129 @@
+package oci
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+const (
+	serviceCompute      = "compute"
+	serviceNetwork      = "network"
+	serviceIdentity     = "identity"
+	serviceBlockStorage = "blockstorage"
+	serviceBastion      = "bastion"
+)
+
+// realmEndpointTemplates are the endpoint templates of the services, filled in with the
+// region and realm domain when the realm domain is overridden.
+var realmEndpointTemplates = map[string]string{
+	serviceCompute:      "https://iaas.%s.%s",
+	serviceNetwork:      "https://iaas.%s.%s",
+	serviceIdentity:     "https://identity.%s.%s",
+	serviceBlockStorage: "https://iaas.%s.%s",
+	serviceBastion:      "https://bastion.%s.oci.%s",
+}
+
+// endpoint returns the endpoint to use for a service, or "" to let the SDK derive it from
+// the region. Rover endpoints take precedence over the generic overrides, which take
+// precedence over the realm domain.
+func (d *Driver) endpoint(service string) string {
+	var override string
+	switch service {
+	case serviceCompute, serviceBlockStorage:
+		if d.IsRover {
+			return d.RoverComputeEndpoint
+		}
+		override = d.ComputeEndpoint
+		if service == serviceBlockStorage {
+			override = d.BlockStorageEndpoint
+		}
+	case serviceNetwork:
+		if d.IsRover {
+			return d.RoverNetworkEndpoint
+		}
+		override = d.NetworkEndpoint
+	case serviceIdentity:
+		if d.IsRover && d.RoverIdentityEndpoint != "" {
+			return d.RoverIdentityEndpoint
+		}
+		override = d.IdentityEndpoint
+	}
+	if override != "" {
+		return override
+	}
+	if d.RealmDomain != "" {
+		return fmt.Sprintf(realmEndpointTemplates[service], common.StringToRegion(d.Region), d.RealmDomain)
+	}
+	return ""
+}
+
+// validateEndpoint checks that an endpoint override is an HTTPS URL.
+func validateEndpoint(endpoint, flag string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q (--%s), must be an https:// URL", endpoint, flag)
+	}
+	return nil
+}
+
+// realmDomainRegex matches a domain name of at least two labels, e.g. oraclecloud.com.
+var realmDomainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]([a-z0-9-]*[a-z0-9])?$`)
+
+// validateRealmDomain checks that a realm domain is the realm's second-level domain, e.g.
+// oraclegovcloud.com, that the service and region labels are put in front of.
+func validateRealmDomain(domain, region string) error {
+	if !realmDomainRegex.MatchString(domain) {
+		return fmt.Errorf("invalid realm domain %q (--oci-realm-domain), must be a domain name such as oraclecloud.com, without scheme or path", domain)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == region || label == "iaas" || label == "identity" || label == "oci" {
+			return fmt.Errorf("invalid realm domain %q (--oci-realm-domain), must be the realm's domain such as oraclecloud.com, without service or region", domain)
+		}
+	}
+	return nil
+}
+
+// validateRegion checks that a region is known to the SDK, either built in or from the
+// region metadata configured for new regions (OCI_REGION_METADATA or ~/.oci/regions-config.json).
+func validateRegion(region string, allowUnknown bool) error {
+	if _, err := common.StringToRegion(region).RealmID(); err != nil && !allowUnknown {
+		return fmt.Errorf("unknown OCI region %q (--oci-region), use --oci-allow-unknown-region to use it anyway", region)
+	}
+	return nil
+}
+
+// rootCAs returns the certificate pool clients verify servers against: the system pool
+// extended with the rover device certificate and the custom CA bundle. It returns nil
+// when neither is configured.
+func (d *Driver) rootCAs() (*x509.CertPool, error) {
+	if !d.IsRover && d.CABundleContent == "" {
+		return nil, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if d.IsRover && !pool.AppendCertsFromPEM([]byte(d.RoverCertContent)) {
+		return nil, errors.New("invalid rover certificate, must contain at least one PEM encoded certificate")
+	}
+	if d.CABundleContent != "" && !pool.AppendCertsFromPEM([]byte(d.CABundleContent)) {
+		return nil, errors.New("invalid CA bundle, must contain at least one PEM encoded certificate")
+	}
+	return pool, nil
+}
+
+// bastionSSHHost returns the host name of the Bastion service's SSH endpoint, which lives
+// next to its API endpoint.
+func (c *Client) bastionSSHHost() string {
+	host := c.bastionClient.Host
+	if u, err := url.Parse(host); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	return "host." + strings.TrimPrefix(host, "host.")
+}
@@ -0,0 +1,256 @@
+package oci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	knownHostsFile        = "known_hosts"
+	defaultHostKeyTimeout = 600
+	hostKeyPollInterval   = 15 * time.Second
+
+	// cloud-init prints these blocks to the serial console once the host keys are generated.
+	hostKeyKeysBegin         = "-----BEGIN SSH HOST KEY KEYS-----"
+	hostKeyKeysEnd           = "-----END SSH HOST KEY KEYS-----"
+	hostKeyFingerprintsBegin = "-----BEGIN SSH HOST KEY FINGERPRINTS-----"
+	hostKeyFingerprintsEnd   = "-----END SSH HOST KEY FINGERPRINTS-----"
+)
+
+// pinHostKeys reads the node's SSH host keys from its console, writes them to a known_hosts
+// file in the machine directory, and checks that the node presents one of them over SSH.
+// The SSH tunnel checks the node against that file on every connection. libmachine's own
+// SSH clients do not check host keys at all, so direct connections are only checked here.
+func (d *Driver) pinHostKeys(oci Client) error {
+	keys, err := d.captureHostKeys(oci)
+	if err != nil {
+		return err
+	}
+	if err := d.writeKnownHosts(oci, keys); err != nil {
+		return err
+	}
+	return d.verifyHostKey(keys)
+}
+
+// captureHostKeys polls the console history of the node until cloud-init has printed its
+// SSH host keys.
+func (d *Driver) captureHostKeys(oci Client) ([]ssh.PublicKey, error) {
+	log.Infof("Reading SSH host keys from the console of instance %s", d.InstanceID)
+	deadline := time.Now().Add(time.Duration(d.HostKeyTimeout) * time.Second)
+	for {
+		console, err := oci.GetConsoleHistory(d.InstanceID)
+		if err != nil {
+			return nil, err
+		}
+		if keys := parseHostKeys(console); len(keys) > 0 {
+			return keys, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no SSH host keys found in the console of instance %s after %d seconds", d.InstanceID, d.HostKeyTimeout)
+		}
+		log.Debugf("SSH host keys not printed to the console yet, retrying in %s", hostKeyPollInterval)
+		time.Sleep(hostKeyPollInterval)
+	}
+}
+
+// writeKnownHosts writes a known_hosts file for the node's addresses into the machine
+// directory. The local end of the SSH tunnel is not listed, as its port changes with every
+// driver process; the tunnel checks the node under its own address instead.
+func (d *Driver) writeKnownHosts(oci Client, keys []ssh.PublicKey) error {
+	var hosts []string
+	for _, private := range []bool{true, false} {
+		ip, err := oci.GetInstanceIP(d.InstanceID, d.NodeCompartmentID, private)
+		if err == nil && ip != "" {
+			hosts = append(hosts, ip)
+		}
+	}
+	if d.AssignIPv6 {
+		ip, err := oci.GetInstanceIPv6(d.InstanceID, d.NodeCompartmentID)
+		if err == nil && ip != "" {
+			hosts = append(hosts, ip)
+		}
+	}
+	if d.UseFQDN {
+		fqdn, err := oci.GetInstanceFQDN(d.InstanceID, d.NodeCompartmentID)
+		if err == nil && fqdn != "" {
+			hosts = append(hosts, fqdn)
+		}
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("instance %s has no address to pin SSH host keys for", d.InstanceID)
+	}
+
+	port := d.SSHPort
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	for i, host := range hosts {
+		hosts[i] = knownhosts.Normalize(net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+
+	var content strings.Builder
+	for _, key := range keys {
+		content.WriteString(knownhosts.Line(hosts, key) + "\n")
+	}
+
+	return ioutil.WriteFile(d.ResolveStorePath(knownHostsFile), []byte(content.String()), 0600)
+}
+
+// checkPinnedHostKey connects to the node's SSH server at target through the hop client and
+// checks the host key it presents against the machine's known_hosts file.
+func (d *Driver) checkPinnedHostKey(hop *ssh.Client, target string) error {
+	hostKeyCallback, err := knownhosts.New(d.ResolveStorePath(knownHostsFile))
+	if err != nil {
+		return fmt.Errorf("could not read pinned SSH host keys: %v", err)
+	}
+	targetAddr, err := net.ResolveTCPAddr("tcp", target)
+	if err != nil {
+		return err
+	}
+
+	conn, err := hop.Dial("tcp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	checked := false
+	var hostKeyErr error
+	config := &ssh.ClientConfig{
+		User: d.GetSSHUsername(),
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			checked = true
+			hostKeyErr = hostKeyCallback(target, targetAddr, key)
+			return hostKeyErr
+		},
+		Timeout: hostKeyPollInterval,
+	}
+	// Without auth methods the handshake stops after the host key check, which is all
+	// that is needed here.
+	client, _, _, err := ssh.NewClientConn(conn, target, config)
+	if client != nil {
+		client.Close()
+	}
+	if hostKeyErr != nil {
+		return fmt.Errorf("instance %s presented an SSH host key that does not match the pinned keys: %v", d.InstanceID, hostKeyErr)
+	}
+	if !checked {
+		return err
+	}
+	return nil
+}
+
+// verifyHostKey connects to the node's SSH server and checks that it presents one of the
+// pinned host keys, retrying until the server is up or the host key timeout expires.
+func (d *Driver) verifyHostKey(keys []ssh.PublicKey) error {
+	signer, err := readSigner(d.GetSSHKeyPath())
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(d.HostKeyTimeout) * time.Second)
+	for {
+		host, err := d.GetSSHHostname()
+		if err != nil {
+			return err
+		}
+		port, err := d.GetSSHPort()
+		if err != nil {
+			return err
+		}
+
+		checked := false
+		var presented ssh.PublicKey
+		config := &ssh.ClientConfig{
+			User: d.GetSSHUsername(),
+			Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+				checked = true
+				for _, k := range keys {
+					if bytes.Equal(k.Marshal(), key.Marshal()) {
+						return nil
+					}
+				}
+				presented = key
+				return errors.New("host key mismatch")
+			},
+			Timeout: hostKeyPollInterval,
+		}
+		client, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
+		if client != nil {
+			client.Close()
+		}
+		if presented != nil {
+			return fmt.Errorf("instance %s presented SSH host key %s, which does not match the keys printed to its console",
+				d.InstanceID, ssh.FingerprintSHA256(presented))
+		}
+		if checked {
+			log.Infof("Verified SSH host key of instance %s", d.InstanceID)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("could not verify SSH host key of instance %s: %v", d.InstanceID, err)
+		}
+		log.Debugf("Could not connect to instance %s over SSH yet: %v", d.InstanceID, err)
+		time.Sleep(hostKeyPollInterval)
+	}
+}
+
+// parseHostKeys extracts the SSH host keys that cloud-init printed to the console. When
+// cloud-init also printed their fingerprints, keys without a matching fingerprint are dropped.
+func parseHostKeys(console string) []ssh.PublicKey {
+	var fingerprints map[string]bool
+	if lines := consoleBlock(console, hostKeyFingerprintsBegin, hostKeyFingerprintsEnd); len(lines) > 0 {
+		fingerprints = make(map[string]bool)
+		for _, line := range lines {
+			for _, field := range strings.Fields(line) {
+				if strings.HasPrefix(field, "SHA256:") {
+					fingerprints[field] = true
+				}
+			}
+		}
+	}
+
+	var keys []ssh.PublicKey
+	for _, line := range consoleBlock(console, hostKeyKeysBegin, hostKeyKeysEnd) {
+		// Console lines may carry a kernel or syslog prefix in front of the key.
+		fields := strings.Fields(line)
+		for i := range fields {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[i:], " ")))
+			if err != nil {
+				continue
+			}
+			if fingerprints == nil || fingerprints[ssh.FingerprintSHA256(key)] {
+				keys = append(keys, key)
+			}
+			break
+		}
+	}
+
+	return keys
+}
+
+// consoleBlock returns the lines between the last begin and end markers in the console output.
+func consoleBlock(console, begin, end string) []string {
+	start := strings.LastIndex(console, begin)
+	if start < 0 {
+		return nil
+	}
+	block := console[start+len(begin):]
+	stop := strings.Index(block, end)
+	if stop < 0 {
+		return nil
+	}
+
+	return strings.Split(block[:stop], "\n")
+}
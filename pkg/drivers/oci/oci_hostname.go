@@ -0,0 +1,110 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const maxHostnameLabelLen = 63
+
+var (
+	invalidHostnameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+	hostnameLabelPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$|^[a-z]$`)
+)
+
+// sanitizeHostnameLabel turns a machine name into a valid RFC 952/1123 hostname label:
+// lower case letters, digits and hyphens, starting with a letter and at most 63 characters.
+func sanitizeHostnameLabel(name string) string {
+	label := invalidHostnameChars.ReplaceAllString(strings.ToLower(name), "-")
+	label = strings.TrimLeft(label, "-0123456789")
+	if len(label) > maxHostnameLabelLen {
+		label = label[:maxHostnameLabelLen]
+	}
+	label = strings.TrimRight(label, "-")
+	if label == "" {
+		label = "node"
+	}
+	return label
+}
+
+// validHostnameLabel reports whether label can be used as a VNIC hostname label.
+func validHostnameLabel(label string) bool {
+	return len(label) <= maxHostnameLabelLen && hostnameLabelPattern.MatchString(label)
+}
+
+// GenerateHostnameLabel returns a hostname label derived from name that is not yet used
+// in the subnet, by appending -2, -3, ... on collision. It returns "" if the subnet has
+// no DNS label, since hostname labels can only be set in DNS-enabled subnets.
+func (c *Client) GenerateHostnameLabel(subnetID, name string) (string, error) {
+	subnet, err := c.virtualNetworkClient.GetSubnet(context.Background(), core.GetSubnetRequest{SubnetId: &subnetID})
+	if err != nil {
+		return "", err
+	}
+	if subnet.DnsLabel == nil || *subnet.DnsLabel == "" {
+		log.Debugf("Subnet %s does not use DNS hostnames, not setting a hostname label", subnetID)
+		return "", nil
+	}
+
+	used := make(map[string]bool)
+	var page *string
+	for {
+		resp, err := c.virtualNetworkClient.ListPrivateIps(context.Background(), core.ListPrivateIpsRequest{
+			SubnetId: &subnetID,
+			Page:     page,
+		})
+		if err != nil {
+			return "", err
+		}
+		for _, privateIP := range resp.Items {
+			if privateIP.HostnameLabel != nil {
+				used[strings.ToLower(*privateIP.HostnameLabel)] = true
+			}
+		}
+		if page = resp.OpcNextPage; resp.OpcNextPage == nil {
+			break
+		}
+	}
+
+	wanted := sanitizeHostnameLabel(name)
+	base, label := wanted, wanted
+	for i := 2; used[label]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		if len(base)+len(suffix) > maxHostnameLabelLen {
+			base = strings.TrimRight(base[:maxHostnameLabelLen-len(suffix)], "-")
+		}
+		label = base + suffix
+	}
+	if label != wanted {
+		log.Infof("Hostname label %s is already used in the subnet, using %s", wanted, label)
+	}
+
+	return label, nil
+}
+
+// GetInstanceFQDN returns the fully qualified domain name of the primary VNIC of a
+// compute instance, e.g. <label>.<subnet>.<vcn>.oraclevcn.com.
+func (c *Client) GetInstanceFQDN(id, compartmentID string) (string, error) {
+	vnic, err := c.getPrimaryVnic(id, compartmentID)
+	if err != nil {
+		return "", err
+	}
+	if vnic.HostnameLabel == nil || *vnic.HostnameLabel == "" {
+		return "", errors.New("instance does not have a hostname label")
+	}
+
+	subnet, err := c.virtualNetworkClient.GetSubnet(context.Background(), core.GetSubnetRequest{SubnetId: vnic.SubnetId})
+	if err != nil {
+		return "", err
+	}
+	if subnet.SubnetDomainName == nil || *subnet.SubnetDomainName == "" {
+		return "", errors.New("instance subnet does not have a DNS domain name")
+	}
+
+	return *vnic.HostnameLabel + "." + *subnet.SubnetDomainName, nil
+}
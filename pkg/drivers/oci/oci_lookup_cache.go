@@ -0,0 +1,122 @@
+package oci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	lookupCacheFile        = "oci-lookups.json"
+	defaultLookupCacheTTL  = 3600
+	lookupKindImage        = "image"
+	lookupKindAvailability = "availability-domains"
+)
+
+// lookupCache is an on-disk cache of image and availability domain lookups, shared by the
+// machines of a store. Entries expire after a TTL. When bypassed, lookups always go to the
+// API and only refresh the cache.
+type lookupCache struct {
+	path   string
+	ttl    time.Duration
+	bypass bool
+}
+
+type lookupCacheEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// newLookupCache returns the lookup cache of the machine store, or nil if caching is disabled.
+func (d *Driver) newLookupCache() *lookupCache {
+	if d.LookupCacheTTL <= 0 || d.StorePath == "" {
+		return nil
+	}
+	return &lookupCache{
+		path:   filepath.Join(d.StorePath, "cache", lookupCacheFile),
+		ttl:    time.Duration(d.LookupCacheTTL) * time.Second,
+		bypass: d.BypassLookupCache,
+	}
+}
+
+// lookupCacheKey returns the cache key of a lookup, from the endpoint it is made against
+// (which identifies the region or device), the compartment and the filters.
+func lookupCacheKey(kind, endpoint, compartmentID string, filters ...string) string {
+	return strings.Join(append([]string{kind, endpoint, compartmentID}, filters...), "|")
+}
+
+// get returns the cached value of a lookup, if there is one that has not expired.
+func (c *lookupCache) get(key string) (string, bool) {
+	if c == nil || c.bypass {
+		return "", false
+	}
+	entry, ok := c.load()[key]
+	if !ok || time.Now().After(entry.Expires) {
+		return "", false
+	}
+	log.Debugf("Using cached %s", key)
+	return entry.Value, true
+}
+
+// put caches the value of a lookup and drops expired entries. Failures are only logged,
+// as the cache is an optimization.
+func (c *lookupCache) put(key, value string) {
+	if c == nil {
+		return
+	}
+	entries := c.load()
+	now := time.Now()
+	for k, entry := range entries {
+		if now.After(entry.Expires) {
+			delete(entries, k)
+		}
+	}
+	entries[key] = lookupCacheEntry{Value: value, Expires: now.Add(c.ttl)}
+
+	if err := c.save(entries); err != nil {
+		log.Debugf("Could not write lookup cache %s: %v", c.path, err)
+	}
+}
+
+func (c *lookupCache) load() map[string]lookupCacheEntry {
+	entries := make(map[string]lookupCacheEntry)
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Debugf("Ignoring unreadable lookup cache %s: %v", c.path, err)
+		return make(map[string]lookupCacheEntry)
+	}
+	return entries
+}
+
+// save writes the cache through a temporary file, so concurrent readers never see a
+// partially written cache.
+func (c *lookupCache) save(entries map[string]lookupCacheEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0750); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), lookupCacheFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,411 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	nodeRoleEtcd         = "etcd"
+	nodeRoleControlPlane = "controlplane"
+	nodeRoleWorker       = "worker"
+
+	nsgClusterTag = "rancher-cluster"
+	nsgRoleTag    = "rancher-role"
+
+	protocolAll  = "all"
+	protocolTCP  = "6"
+	protocolUDP  = "17"
+	anywhereCIDR = "0.0.0.0/0"
+)
+
+// nodeRoles lists the roles that get their own managed network security group.
+var nodeRoles = []string{nodeRoleEtcd, nodeRoleControlPlane, nodeRoleWorker}
+
+// nsgPortRule describes an ingress rule for a port range. When fromRoles is
+// set the rule is added once for each role's NSG, otherwise it applies to the
+// configured external CIDR.
+type nsgPortRule struct {
+	description string
+	protocol    string
+	min, max    int
+	fromRoles   []string
+}
+
+// nsgRules returns the ingress rules for a role, based on the RKE port requirements.
+func nsgRules(role string) []nsgPortRule {
+	rules := []nsgPortRule{
+		{description: "SSH provisioning", protocol: protocolTCP, min: 22, max: 22},
+		{description: "Docker daemon", protocol: protocolTCP, min: defaultDockerPort, max: defaultDockerPort},
+		{description: "Overlay network (VXLAN)", protocol: protocolUDP, min: 8472, max: 8472, fromRoles: nodeRoles},
+		{description: "Kubelet API", protocol: protocolTCP, min: 10250, max: 10250, fromRoles: []string{nodeRoleControlPlane}},
+	}
+
+	switch role {
+	case nodeRoleEtcd:
+		rules = append(rules,
+			nsgPortRule{description: "etcd client and peer", protocol: protocolTCP, min: 2379, max: 2380, fromRoles: []string{nodeRoleEtcd, nodeRoleControlPlane}})
+	case nodeRoleControlPlane:
+		rules = append(rules,
+			nsgPortRule{description: "Kubernetes API", protocol: protocolTCP, min: 6443, max: 6443},
+			nsgPortRule{description: "Kubernetes API", protocol: protocolTCP, min: 6443, max: 6443, fromRoles: nodeRoles})
+	case nodeRoleWorker:
+		rules = append(rules,
+			nsgPortRule{description: "Ingress HTTP", protocol: protocolTCP, min: 80, max: 80},
+			nsgPortRule{description: "Ingress HTTPS", protocol: protocolTCP, min: 443, max: 443},
+			nsgPortRule{description: "NodePort services", protocol: protocolTCP, min: 30000, max: 32767},
+			nsgPortRule{description: "NodePort services", protocol: protocolUDP, min: 30000, max: 32767})
+	}
+
+	return rules
+}
+
+// nsgDisplayName returns the display name of the managed NSG of a role in a cluster.
+func nsgDisplayName(clusterName, role string) string {
+	return fmt.Sprintf("rancher-%s-%s", clusterName, role)
+}
+
+// EnsureClusterNSGs finds or creates the per-role network security groups of a cluster
+// and returns their IDs keyed by role. The NSGs are given any of their rules they are
+// missing, whether they were created by this call or by another node.
+func (c *Client) EnsureClusterNSGs(compartmentID, vcnID, clusterName, sourceCIDR string) (map[string]string, error) {
+	ids := make(map[string]string, len(nodeRoles))
+	for _, role := range nodeRoles {
+		displayName := nsgDisplayName(clusterName, role)
+		id, err := c.findNSG(compartmentID, vcnID, displayName)
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			id, err = c.createNSG(compartmentID, vcnID, clusterName, role)
+			if err != nil {
+				return nil, err
+			}
+
+			// Nodes created in parallel may each have created the NSG; all of them
+			// settle on the oldest one and delete their own duplicate.
+			oldest, err := c.findNSG(compartmentID, vcnID, displayName)
+			if err != nil {
+				return nil, err
+			}
+			if oldest != id {
+				log.Infof("Network security group %s was created concurrently, using %s", displayName, oldest)
+				if err := c.deleteNSG(id); err != nil {
+					return nil, err
+				}
+				id = oldest
+			}
+		}
+		ids[role] = id
+	}
+
+	// Rules can only reference the other roles' NSGs once they all exist.
+	for _, role := range nodeRoles {
+		err := c.ensureNSGRules(nsgDisplayName(clusterName, role), ids[role], buildSecurityRules(role, ids, sourceCIDR))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// RemoveClusterNSGs deletes the managed network security groups of a cluster once
+// none of them has any member VNICs left.
+func (c *Client) RemoveClusterNSGs(compartmentID, vcnID, clusterName, sourceCIDR string) error {
+	ids, inUse, err := c.clusterNSGsInUse(compartmentID, vcnID, clusterName)
+	if err != nil || inUse {
+		return err
+	}
+
+	// The NSGs reference each other, so drop all rules before deleting any of them.
+	for _, id := range ids {
+		if err := c.clearNSGRules(id); err != nil {
+			return err
+		}
+	}
+
+	// A node may have joined the NSGs in the meantime. Give them their rules back and
+	// leave them to the last node of the cluster.
+	ids, inUse, err = c.clusterNSGsInUse(compartmentID, vcnID, clusterName)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		if len(ids) < len(nodeRoles) {
+			return nil
+		}
+		for _, role := range nodeRoles {
+			err := c.ensureNSGRules(nsgDisplayName(clusterName, role), ids[role], buildSecurityRules(role, ids, sourceCIDR))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for role, id := range ids {
+		log.Infof("Deleting network security group %s", nsgDisplayName(clusterName, role))
+		if err := c.deleteNSG(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clusterNSGsInUse returns the IDs of the managed NSGs of a cluster keyed by role, and
+// whether any of them has member VNICs.
+func (c *Client) clusterNSGsInUse(compartmentID, vcnID, clusterName string) (map[string]string, bool, error) {
+	ids := make(map[string]string, len(nodeRoles))
+	inUse := false
+	for _, role := range nodeRoles {
+		id, err := c.findNSG(compartmentID, vcnID, nsgDisplayName(clusterName, role))
+		if err != nil {
+			return nil, false, err
+		}
+		if id == "" {
+			continue
+		}
+		vnics, err := c.virtualNetworkClient.ListNetworkSecurityGroupVnics(context.Background(), core.ListNetworkSecurityGroupVnicsRequest{
+			NetworkSecurityGroupId: common.String(id),
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(vnics.Items) > 0 {
+			log.Debugf("Network security group %s still has %d member(s)", nsgDisplayName(clusterName, role), len(vnics.Items))
+			inUse = true
+		}
+		ids[role] = id
+	}
+
+	return ids, inUse, nil
+}
+
+// findNSG returns the ID of the oldest NSG with the given name that is not being deleted,
+// or "" if there is none. It waits for the NSG to become available.
+func (c *Client) findNSG(compartmentID, vcnID, displayName string) (string, error) {
+	resp, err := c.virtualNetworkClient.ListNetworkSecurityGroups(context.Background(), core.ListNetworkSecurityGroupsRequest{
+		CompartmentId: &compartmentID,
+		VcnId:         &vcnID,
+		DisplayName:   &displayName,
+		SortBy:        core.ListNetworkSecurityGroupsSortByTimecreated,
+		SortOrder:     core.ListNetworkSecurityGroupsSortOrderAsc,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, nsg := range resp.Items {
+		switch nsg.LifecycleState {
+		case core.NetworkSecurityGroupLifecycleStateAvailable:
+			return *nsg.Id, nil
+		case core.NetworkSecurityGroupLifecycleStateProvisioning:
+			return *nsg.Id, c.waitForNSG(*nsg.Id)
+		}
+	}
+
+	return "", nil
+}
+
+// createNSG creates a managed NSG for a role and waits for it to become available.
+func (c *Client) createNSG(compartmentID, vcnID, clusterName, role string) (string, error) {
+	displayName := nsgDisplayName(clusterName, role)
+	log.Infof("Creating network security group %s", displayName)
+	resp, err := c.virtualNetworkClient.CreateNetworkSecurityGroup(context.Background(), core.CreateNetworkSecurityGroupRequest{
+		CreateNetworkSecurityGroupDetails: core.CreateNetworkSecurityGroupDetails{
+			CompartmentId: &compartmentID,
+			VcnId:         &vcnID,
+			DisplayName:   &displayName,
+			FreeformTags: map[string]string{
+				nsgClusterTag: clusterName,
+				nsgRoleTag:    role,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return *resp.Id, c.waitForNSG(*resp.Id)
+}
+
+// waitForNSG waits for an NSG to become available.
+func (c *Client) waitForNSG(id string) error {
+	// wait until lifecycle status is Available
+	pollUntilAvailable := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(core.GetNetworkSecurityGroupResponse); ok {
+			return converted.LifecycleState != core.NetworkSecurityGroupLifecycleStateAvailable
+		}
+		return true
+	}
+
+	_, err := c.virtualNetworkClient.GetNetworkSecurityGroup(context.Background(), core.GetNetworkSecurityGroupRequest{
+		NetworkSecurityGroupId: &id,
+		RequestMetadata:        helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilAvailable),
+	})
+	return err
+}
+
+// deleteNSG deletes an NSG, ignoring NSGs that are already gone.
+func (c *Client) deleteNSG(id string) error {
+	_, err := c.virtualNetworkClient.DeleteNetworkSecurityGroup(context.Background(), core.DeleteNetworkSecurityGroupRequest{
+		NetworkSecurityGroupId: &id,
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ensureNSGRules adds the rules an NSG is missing, so that an NSG whose rules were
+// never (fully) added, e.g. because the node that created it failed, is completed.
+func (c *Client) ensureNSGRules(displayName, id string, rules []core.AddSecurityRuleDetails) error {
+	existing := make(map[string]bool)
+	var page *string
+	for {
+		resp, err := c.virtualNetworkClient.ListNetworkSecurityGroupSecurityRules(context.Background(), core.ListNetworkSecurityGroupSecurityRulesRequest{
+			NetworkSecurityGroupId: &id,
+			Page:                   page,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rule := range resp.Items {
+			existing[securityRuleKey(string(rule.Direction), rule.Protocol, rule.Source, rule.Destination, rule.TcpOptions, rule.UdpOptions)] = true
+		}
+		if page = resp.OpcNextPage; resp.OpcNextPage == nil {
+			break
+		}
+	}
+
+	var missing []core.AddSecurityRuleDetails
+	for _, rule := range rules {
+		key := securityRuleKey(string(rule.Direction), rule.Protocol, rule.Source, rule.Destination, rule.TcpOptions, rule.UdpOptions)
+		if !existing[key] {
+			existing[key] = true
+			missing = append(missing, rule)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Infof("Adding %d security rule(s) to network security group %s", len(missing), displayName)
+	_, err := c.virtualNetworkClient.AddNetworkSecurityGroupSecurityRules(context.Background(), core.AddNetworkSecurityGroupSecurityRulesRequest{
+		NetworkSecurityGroupId: &id,
+		AddNetworkSecurityGroupSecurityRulesDetails: core.AddNetworkSecurityGroupSecurityRulesDetails{
+			SecurityRules: missing,
+		},
+	})
+	return err
+}
+
+// securityRuleKey identifies a security rule by what it allows, ignoring its description.
+func securityRuleKey(direction string, protocol, source, destination *string, tcp *core.TcpOptions, udp *core.UdpOptions) string {
+	portRange := func(r *core.PortRange) string {
+		if r == nil || r.Min == nil || r.Max == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d-%d", *r.Min, *r.Max)
+	}
+	ports := ""
+	if tcp != nil {
+		ports = portRange(tcp.DestinationPortRange)
+	} else if udp != nil {
+		ports = portRange(udp.DestinationPortRange)
+	}
+	value := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%s", direction, value(protocol), value(source), value(destination), ports)
+}
+
+// isNotFound reports whether err is a "not found" error from the OCI API.
+func isNotFound(err error) bool {
+	serviceErr, ok := common.IsServiceError(err)
+	return ok && serviceErr.GetHTTPStatusCode() == 404
+}
+
+// clearNSGRules removes all security rules from an NSG.
+func (c *Client) clearNSGRules(id string) error {
+	var ruleIDs []string
+	var page *string
+	for {
+		resp, err := c.virtualNetworkClient.ListNetworkSecurityGroupSecurityRules(context.Background(), core.ListNetworkSecurityGroupSecurityRulesRequest{
+			NetworkSecurityGroupId: &id,
+			Page:                   page,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rule := range resp.Items {
+			ruleIDs = append(ruleIDs, *rule.Id)
+		}
+		if page = resp.OpcNextPage; resp.OpcNextPage == nil {
+			break
+		}
+	}
+	if len(ruleIDs) == 0 {
+		return nil
+	}
+
+	_, err := c.virtualNetworkClient.RemoveNetworkSecurityGroupSecurityRules(context.Background(), core.RemoveNetworkSecurityGroupSecurityRulesRequest{
+		NetworkSecurityGroupId: &id,
+		RemoveNetworkSecurityGroupSecurityRulesDetails: core.RemoveNetworkSecurityGroupSecurityRulesDetails{
+			SecurityRuleIds: ruleIDs,
+		},
+	})
+	return err
+}
+
+// buildSecurityRules converts the rules of a role into OCI security rules.
+func buildSecurityRules(role string, ids map[string]string, sourceCIDR string) []core.AddSecurityRuleDetails {
+	rules := []core.AddSecurityRuleDetails{
+		{
+			Description:     common.String("Allow all outbound traffic"),
+			Direction:       core.AddSecurityRuleDetailsDirectionEgress,
+			Protocol:        common.String(protocolAll),
+			Destination:     common.String(anywhereCIDR),
+			DestinationType: core.AddSecurityRuleDetailsDestinationTypeCidrBlock,
+		},
+	}
+
+	for _, r := range nsgRules(role) {
+		rule := core.AddSecurityRuleDetails{
+			Description: common.String(r.description),
+			Direction:   core.AddSecurityRuleDetailsDirectionIngress,
+			Protocol:    common.String(r.protocol),
+		}
+		portRange := &core.PortRange{Min: common.Int(r.min), Max: common.Int(r.max)}
+		if r.protocol == protocolTCP {
+			rule.TcpOptions = &core.TcpOptions{DestinationPortRange: portRange}
+		} else {
+			rule.UdpOptions = &core.UdpOptions{DestinationPortRange: portRange}
+		}
+
+		if len(r.fromRoles) == 0 {
+			rule.Source = common.String(sourceCIDR)
+			rule.SourceType = core.AddSecurityRuleDetailsSourceTypeCidrBlock
+			rules = append(rules, rule)
+			continue
+		}
+		for _, from := range r.fromRoles {
+			fromRule := rule
+			fromRule.Source = common.String(ids[from])
+			fromRule.SourceType = core.AddSecurityRuleDetailsSourceTypeNetworkSecurityGroup
+			rules = append(rules, fromRule)
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,54 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	capacityFallbackFail     = "fail"
+	capacityFallbackOnDemand = "on-demand"
+)
+
+// CheckCapacityReservation verifies that a capacity reservation is active, is in the
+// given availability domain, and has unused capacity for the shape (in the fault
+// domain, if one is given).
+func (c *Client) CheckCapacityReservation(id, availabilityDomain, faultDomain, shape string) error {
+	resp, err := c.computeClient.GetComputeCapacityReservation(context.Background(), core.GetComputeCapacityReservationRequest{
+		CapacityReservationId: &id,
+	})
+	if err != nil {
+		return err
+	}
+	reservation := resp.ComputeCapacityReservation
+
+	if reservation.LifecycleState != core.ComputeCapacityReservationLifecycleStateActive {
+		return fmt.Errorf("capacity reservation %s is %s", id, reservation.LifecycleState)
+	}
+	// Just in case shortened or lower-case availability domain name was used
+	if !strings.Contains(*reservation.AvailabilityDomain, strings.ToUpper(availabilityDomain)) {
+		return fmt.Errorf("capacity reservation %s is in availability domain %s, not %s", id, *reservation.AvailabilityDomain, availabilityDomain)
+	}
+
+	for _, config := range reservation.InstanceReservationConfigs {
+		if !strings.EqualFold(*config.InstanceShape, shape) {
+			continue
+		}
+		if faultDomain != "" && config.FaultDomain != nil && !strings.EqualFold(*config.FaultDomain, faultDomain) {
+			continue
+		}
+		if *config.UsedCount < *config.ReservedCount {
+			log.Debugf("Capacity reservation %s has %d of %d %s instance(s) available", id, *config.ReservedCount-*config.UsedCount, *config.ReservedCount, shape)
+			return nil
+		}
+	}
+
+	if faultDomain != "" {
+		return fmt.Errorf("capacity reservation %s has no capacity left for shape %s in fault domain %s", id, shape, faultDomain)
+	}
+	return fmt.Errorf("capacity reservation %s has no capacity left for shape %s", id, shape)
+}
@@ -0,0 +1,144 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// platformOption is a shielded instance or confidential computing option, along with
+// the shape's support for it.
+type platformOption struct {
+	name    string
+	enabled bool
+	allowed []bool
+}
+
+// GetShapePlatformConfigOptions returns the platform configuration options supported by a shape.
+func (c *Client) GetShapePlatformConfigOptions(compartmentID, availabilityDomain, shape string) (*core.ShapePlatformConfigOptions, error) {
+	var page *string
+	for {
+		req := core.ListShapesRequest{
+			CompartmentId: &compartmentID,
+			Page:          page,
+		}
+		if availabilityDomain != "" {
+			req.AvailabilityDomain = &availabilityDomain
+		}
+		resp, err := c.computeClient.ListShapes(context.Background(), req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range resp.Items {
+			if strings.EqualFold(*s.Shape, shape) {
+				if s.PlatformConfigOptions == nil {
+					return nil, fmt.Errorf("shape %s does not support platform configuration (shielded instances or confidential computing)", shape)
+				}
+				return s.PlatformConfigOptions, nil
+			}
+		}
+		if page = resp.OpcNextPage; resp.OpcNextPage == nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("could not find shape %s", shape)
+}
+
+// hasPlatformConfig reports whether any shielded instance or confidential computing option is set.
+func (d *Driver) hasPlatformConfig() bool {
+	return d.SecureBoot || d.MeasuredBoot || d.TrustedPlatformModule || d.MemoryEncryption
+}
+
+// validatePlatformConfig checks the requested platform options against the options supported by the shape.
+func (d *Driver) validatePlatformConfig(options *core.ShapePlatformConfigOptions) error {
+	requested := []platformOption{
+		{name: "Secure Boot", enabled: d.SecureBoot},
+		{name: "Measured Boot", enabled: d.MeasuredBoot},
+		{name: "Trusted Platform Module", enabled: d.TrustedPlatformModule},
+		{name: "memory encryption (confidential computing)", enabled: d.MemoryEncryption},
+	}
+	if options.SecureBootOptions != nil {
+		requested[0].allowed = options.SecureBootOptions.AllowedValues
+	}
+	if options.MeasuredBootOptions != nil {
+		requested[1].allowed = options.MeasuredBootOptions.AllowedValues
+	}
+	if options.TrustedPlatformModuleOptions != nil {
+		requested[2].allowed = options.TrustedPlatformModuleOptions.AllowedValues
+	}
+	if options.MemoryEncryptionOptions != nil {
+		requested[3].allowed = options.MemoryEncryptionOptions.AllowedValues
+	}
+
+	for _, option := range requested {
+		if !option.enabled {
+			continue
+		}
+		supported := false
+		for _, allowed := range option.allowed {
+			supported = supported || allowed
+		}
+		if !supported {
+			return fmt.Errorf("shape %s does not support %s", d.Shape, option.name)
+		}
+	}
+
+	return nil
+}
+
+// buildPlatformConfig returns the launch platform configuration matching the shape's platform type.
+func (d *Driver) buildPlatformConfig(options *core.ShapePlatformConfigOptions) (core.LaunchInstancePlatformConfig, error) {
+	secureBoot := common.Bool(d.SecureBoot)
+	measuredBoot := common.Bool(d.MeasuredBoot)
+	tpm := common.Bool(d.TrustedPlatformModule)
+	memoryEncryption := common.Bool(d.MemoryEncryption)
+
+	switch options.Type {
+	case core.ShapePlatformConfigOptionsTypeAmdVm:
+		return core.AmdVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelVm:
+		return core.IntelVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdMilanBm:
+		return core.AmdMilanBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdMilanBmGpu:
+		return core.AmdMilanBmGpuLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdRomeBm:
+		return core.AmdRomeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdRomeBmGpu:
+		return core.AmdRomeBmGpuLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeGenericBm:
+		return core.GenericBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelIcelakeBm:
+		return core.IntelIcelakeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelSkylakeBm:
+		return core.IntelSkylakeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot,
+			IsTrustedPlatformModuleEnabled: tpm, IsMemoryEncryptionEnabled: memoryEncryption}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported platform type %s for shape %s", options.Type, d.Shape)
+}
+
+// buildLaunchOptions returns the launch options for the requested network and boot volume
+// attachment types, or nil if the image defaults should be used.
+func (d *Driver) buildLaunchOptions() *core.LaunchOptions {
+	if d.NetworkType == "" && d.BootVolumeType == "" {
+		return nil
+	}
+	return &core.LaunchOptions{
+		NetworkType:    core.LaunchOptionsNetworkTypeEnum(d.NetworkType),
+		BootVolumeType: core.LaunchOptionsBootVolumeTypeEnum(d.BootVolumeType),
+	}
+}
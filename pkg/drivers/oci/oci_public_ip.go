@@ -0,0 +1,256 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	assignPublicIPTrue     = "true"
+	assignPublicIPFalse    = "false"
+	assignPublicIPReserved = "reserved"
+
+	publicIPPoolOCIDPfx = "ocid1.publicippool."
+)
+
+// AssignReservedPublicIP binds a reserved public IP to the primary private IP of a
+// compute instance and waits for the assignment to complete. It uses the public IP
+// with the given OCID if set, otherwise a reserved public IP named displayName that
+// was left behind by a previous incarnation of the node, otherwise it
+// allocates a new one from the given pool (name or OCID) or Oracle's pool.
+// It returns the OCID of the public IP.
+func (c *Client) AssignReservedPublicIP(id, compartmentID, displayName, publicIPID, pool string) (string, error) {
+	privateIP, err := c.getPrimaryPrivateIP(id, compartmentID)
+	if err != nil {
+		return "", err
+	}
+
+	if publicIPID == "" {
+		publicIPID, err = c.findReusablePublicIP(compartmentID, displayName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if publicIPID != "" {
+		log.Infof("Assigning reserved public IP %s to private IP %s", publicIPID, *privateIP.IpAddress)
+		_, err = c.virtualNetworkClient.UpdatePublicIp(context.Background(), core.UpdatePublicIpRequest{
+			PublicIpId: &publicIPID,
+			UpdatePublicIpDetails: core.UpdatePublicIpDetails{
+				PrivateIpId: privateIP.Id,
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+	} else {
+		details := core.CreatePublicIpDetails{
+			CompartmentId: &compartmentID,
+			Lifetime:      core.CreatePublicIpDetailsLifetimeReserved,
+			DisplayName:   &displayName,
+			PrivateIpId:   privateIP.Id,
+		}
+		if pool != "" {
+			poolID, err := c.getPublicIPPoolID(compartmentID, pool)
+			if err != nil {
+				return "", err
+			}
+			details.PublicIpPoolId = &poolID
+		}
+
+		log.Infof("Allocating reserved public IP for private IP %s", *privateIP.IpAddress)
+		resp, err := c.virtualNetworkClient.CreatePublicIp(context.Background(), core.CreatePublicIpRequest{
+			CreatePublicIpDetails: details,
+		})
+		if err != nil {
+			return "", err
+		}
+		publicIPID = *resp.Id
+	}
+
+	// wait until lifecycle status is Assigned
+	pollUntilAssigned := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(core.GetPublicIpResponse); ok {
+			return converted.LifecycleState != core.PublicIpLifecycleStateAssigned
+		}
+		return true
+	}
+
+	publicIP, err := c.virtualNetworkClient.GetPublicIp(context.Background(), core.GetPublicIpRequest{
+		PublicIpId:      &publicIPID,
+		RequestMetadata: helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilAssigned),
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Assigned reserved public IP %s to private IP %s", *publicIP.IpAddress, *privateIP.IpAddress)
+
+	return publicIPID, nil
+}
+
+// DeletePublicIP releases a reserved public IP by id.
+func (c *Client) DeletePublicIP(id string) error {
+	_, err := c.virtualNetworkClient.DeletePublicIp(context.Background(), core.DeletePublicIpRequest{PublicIpId: &id})
+	return err
+}
+
+// UnassignPublicIP unbinds a reserved public IP from its private IP and waits until it
+// is available for another node. Public IPs that no longer exist are ignored.
+func (c *Client) UnassignPublicIP(id string) error {
+	_, err := c.virtualNetworkClient.UpdatePublicIp(context.Background(), core.UpdatePublicIpRequest{
+		PublicIpId: &id,
+		UpdatePublicIpDetails: core.UpdatePublicIpDetails{
+			PrivateIpId: common.String(""),
+		},
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.waitForPublicIPAvailable(id)
+}
+
+// waitForPublicIPAvailable waits until a reserved public IP is no longer assigned.
+func (c *Client) waitForPublicIPAvailable(id string) error {
+	// wait until lifecycle status is Available
+	pollUntilAvailable := func(r common.OCIOperationResponse) bool {
+		if converted, ok := r.Response.(core.GetPublicIpResponse); ok {
+			return converted.LifecycleState != core.PublicIpLifecycleStateAvailable
+		}
+		return true
+	}
+
+	_, err := c.virtualNetworkClient.GetPublicIp(context.Background(), core.GetPublicIpRequest{
+		PublicIpId:      &id,
+		RequestMetadata: helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilAvailable),
+	})
+	return err
+}
+
+// findReusablePublicIP returns the ID of a reserved public IP with the given name that
+// is not in use, or "" if there is none. Besides unassigned IPs, this includes IPs that
+// are still bound to the private IP of a terminated instance, e.g. because the node was
+// recreated before its predecessor was gone.
+func (c *Client) findReusablePublicIP(compartmentID, displayName string) (string, error) {
+	var page *string
+	for {
+		resp, err := c.virtualNetworkClient.ListPublicIps(context.Background(), core.ListPublicIpsRequest{
+			Scope:         core.ListPublicIpsScopeRegion,
+			CompartmentId: &compartmentID,
+			Lifetime:      core.ListPublicIpsLifetimeReserved,
+			Page:          page,
+		})
+		if err != nil {
+			return "", err
+		}
+		for _, publicIP := range resp.Items {
+			if publicIP.DisplayName == nil || *publicIP.DisplayName != displayName {
+				continue
+			}
+			switch publicIP.LifecycleState {
+			case core.PublicIpLifecycleStateAvailable:
+				return *publicIP.Id, nil
+			case core.PublicIpLifecycleStateAssigned, core.PublicIpLifecycleStateUnassigning:
+				orphaned, err := c.isPrivateIPGone(publicIP.AssignedEntityId)
+				if err != nil {
+					return "", err
+				}
+				if !orphaned {
+					continue
+				}
+				if publicIP.LifecycleState == core.PublicIpLifecycleStateUnassigning {
+					if err := c.waitForPublicIPAvailable(*publicIP.Id); err != nil {
+						return "", err
+					}
+				}
+				return *publicIP.Id, nil
+			}
+		}
+		if page = resp.OpcNextPage; resp.OpcNextPage == nil {
+			break
+		}
+	}
+
+	return "", nil
+}
+
+// isPrivateIPGone reports whether a private IP no longer exists, or belongs to a
+// VNIC that is being detached because its instance is terminating.
+func (c *Client) isPrivateIPGone(id *string) (bool, error) {
+	if id == nil {
+		return true, nil
+	}
+
+	privateIP, err := c.virtualNetworkClient.GetPrivateIp(context.Background(), core.GetPrivateIpRequest{PrivateIpId: id})
+	if isNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	vnic, err := c.virtualNetworkClient.GetVnic(context.Background(), core.GetVnicRequest{VnicId: privateIP.VnicId})
+	if isNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return vnic.LifecycleState == core.VnicLifecycleStateTerminating || vnic.LifecycleState == core.VnicLifecycleStateTerminated, nil
+}
+
+// getPublicIPPoolID resolves a public IP pool name (or OCID) to its OCID.
+func (c *Client) getPublicIPPoolID(compartmentID, pool string) (string, error) {
+	if strings.HasPrefix(pool, publicIPPoolOCIDPfx) {
+		return pool, nil
+	}
+
+	resp, err := c.virtualNetworkClient.ListPublicIpPools(context.Background(), core.ListPublicIpPoolsRequest{
+		CompartmentId: &compartmentID,
+		DisplayName:   &pool,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, p := range resp.Items {
+		if p.LifecycleState == core.PublicIpPoolLifecycleStateActive {
+			return *p.Id, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not find an active public IP pool named %s", pool)
+}
+
+// getPrimaryPrivateIP returns the primary private IP of the primary VNIC of a compute instance.
+func (c *Client) getPrimaryPrivateIP(id, compartmentID string) (core.PrivateIp, error) {
+	vnic, err := c.getPrimaryVnic(id, compartmentID)
+	if err != nil {
+		return core.PrivateIp{}, err
+	}
+
+	privateIPs, err := c.virtualNetworkClient.ListPrivateIps(context.Background(), core.ListPrivateIpsRequest{
+		VnicId: vnic.Id,
+	})
+	if err != nil {
+		return core.PrivateIp{}, err
+	}
+
+	for _, privateIP := range privateIPs.Items {
+		if privateIP.IsPrimary != nil && *privateIP.IsPrimary {
+			return privateIP, nil
+		}
+	}
+
+	return core.PrivateIp{}, errors.New("primary VNIC does not have a primary private IP")
+}
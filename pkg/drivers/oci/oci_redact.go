@@ -0,0 +1,72 @@
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// redactedText replaces secrets in logs, as in libmachine's own log history.
+const redactedText = "<REDACTED>"
+
+// minRedactedSecretLength is the length below which a secret value is not masked by
+// itself: a short value such as "abc" would also mask every other occurrence of those
+// characters and garble the text. PEM blocks and URL passwords are masked regardless.
+const minRedactedSecretLength = 8
+
+// pemBlockRegex matches any PEM block, e.g. private keys and certificates.
+var pemBlockRegex = regexp.MustCompile("(?s)-----BEGIN [A-Z0-9 ]+-----.*?-----END [A-Z0-9 ]+-----")
+
+// urlPasswordRegex matches the password in the user info of a URL, e.g. of the proxy.
+var urlPasswordRegex = regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]*@`)
+
+// redactedMetadataKeys are the instance metadata keys whose values are never logged:
+// the authorized SSH keys and the cloud-init user data, which may carry credentials.
+var redactedMetadataKeys = map[string]bool{
+	"ssh_authorized_keys": true,
+	"user_data":           true,
+}
+
+// secrets returns the secret values of the driver configuration.
+func (d *Driver) secrets() []string {
+	return []string{
+		d.PrivateKeyContents,
+		d.PrivateKeyPassphrase,
+		d.RoverCertContent,
+		d.JumpHostKeyContents,
+		d.ProxyPassword,
+		d.ClientKeyContent,
+	}
+}
+
+// redact masks the driver's secret values, any PEM blocks and any URL passwords in a
+// text about to be logged.
+func (d *Driver) redact(text string) string {
+	for _, secret := range d.secrets() {
+		if len(strings.TrimSpace(secret)) >= minRedactedSecretLength {
+			text = strings.ReplaceAll(text, secret, redactedText)
+		}
+	}
+	text = pemBlockRegex.ReplaceAllString(text, redactedText)
+	return urlPasswordRegex.ReplaceAllString(text, "${1}"+redactedText+"@")
+}
+
+// redactLaunchRequest formats a launch request for logging, with the values of the
+// sensitive metadata keys masked.
+func (d *Driver) redactLaunchRequest(request core.LaunchInstanceRequest) string {
+	metadata := make(map[string]string, len(request.Metadata))
+	for key, value := range request.Metadata {
+		if redactedMetadataKeys[key] {
+			value = redactedText
+		}
+		metadata[key] = value
+	}
+	request.Metadata = metadata
+	if len(request.ExtendedMetadata) > 0 {
+		request.ExtendedMetadata = map[string]interface{}{redactedText: redactedText}
+	}
+
+	return d.redact(fmt.Sprintf("%+v", request))
+}
@@ -0,0 +1,127 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const (
+	roverDefaultFaultDomain    = "FAULT-DOMAIN-1"
+	roverDefaultBootVolumeSize = 50
+	// roverAPIPort is the port the API services of a rover device listen on.
+	roverAPIPort     = "12050"
+	roverDialTimeout = 10 * time.Second
+)
+
+// roverEndpoint returns the API endpoint of a rover device from its address, which is a
+// host name or IP address with an optional port.
+func roverEndpoint(address string) (string, error) {
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "https://"), "/")
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = strings.Trim(address, "[]"), roverAPIPort
+	}
+	if host == "" || strings.ContainsAny(host, "/?#") {
+		return "", fmt.Errorf("invalid rover device address %q (--oci-rover-address)", address)
+	}
+	return "https://" + net.JoinHostPort(host, port), nil
+}
+
+// checkRoverEndpoint sends a request to an endpoint of a rover device through the given
+// transport, which verifies the device certificate. Any HTTP response will do.
+func checkRoverEndpoint(endpoint string, transport *http.Transport) error {
+	client := &http.Client{Transport: transport, Timeout: roverDialTimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return fmt.Errorf("could not reach rover endpoint %s with the given certificate: %v", endpoint, err)
+	}
+	return resp.Body.Close()
+}
+
+// preCreateCheckRover verifies that the rover device is reachable and trusted, the
+// credentials are accepted, and the image and subnet exist on the device.
+func (d *Driver) preCreateCheckRover() error {
+	transport, err := d.newTransport()
+	if err != nil {
+		return err
+	}
+	log.Infof("Verifying rover device endpoints... ")
+	endpoints := []string{d.RoverComputeEndpoint, d.RoverNetworkEndpoint}
+	if d.RoverIdentityEndpoint != "" {
+		endpoints = append(endpoints, d.RoverIdentityEndpoint)
+	}
+	checked := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		if checked[endpoint] {
+			continue
+		}
+		checked[endpoint] = true
+		if err := checkRoverEndpoint(endpoint, transport); err != nil {
+			return err
+		}
+	}
+
+	oci, err := d.initOCIClient()
+	if err != nil {
+		return err
+	}
+
+	// Check that the node image exists on the device, which will also validate the credentials.
+	log.Infof("Verifying node image availability on the rover device... ")
+	if _, err := oci.getImageID(d.NodeCompartmentID, d.Image); err != nil {
+		return err
+	}
+
+	log.Infof("Verifying subnet on the rover device... ")
+	_, err = oci.virtualNetworkClient.GetSubnet(context.Background(), core.GetSubnetRequest{SubnetId: &d.SubnetID})
+	if err != nil {
+		return fmt.Errorf("could not find subnet %s on the rover device: %v", d.SubnetID, err)
+	}
+
+	return nil
+}
+
+// roverAvailabilityDomain returns the availability domain to launch a node on a rover device in.
+// Devices name their availability domains differently, so the domain is discovered from the
+// subnet (when it is AD-specific) or the device's identity service. A configured domain is
+// matched against the discovered ones, in case a shortened or lower-case name was used.
+func (c *Client) roverAvailabilityDomain(availabilityDomain, compartmentID, subnetID string) (string, error) {
+	var discovered []string
+	subnet, err := c.virtualNetworkClient.GetSubnet(context.Background(), core.GetSubnetRequest{SubnetId: &subnetID})
+	if err != nil {
+		return "", err
+	}
+	if subnet.AvailabilityDomain != nil && *subnet.AvailabilityDomain != "" {
+		discovered = append(discovered, *subnet.AvailabilityDomain)
+	}
+	if !c.skipIdentity {
+		ads, err := c.listAvailabilityDomains(compartmentID)
+		if err != nil {
+			log.Debugf("Could not list availability domains of the rover device: %v", err)
+		}
+		discovered = append(discovered, ads...)
+	}
+
+	if availabilityDomain == "" {
+		if len(discovered) == 0 {
+			return "", errors.New("could not discover the availability domain of the rover device, specify it with --oci-node-availability-domain")
+		}
+		log.Debugf("Using availability domain %s of the rover device", discovered[0])
+		return discovered[0], nil
+	}
+
+	for _, ad := range discovered {
+		if strings.Contains(ad, strings.ToUpper(availabilityDomain)) {
+			return ad, nil
+		}
+	}
+	return availabilityDomain, nil
+}
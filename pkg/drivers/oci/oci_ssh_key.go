@@ -0,0 +1,100 @@
+package oci
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshKeyTypeRSA2048   = "rsa-2048"
+	sshKeyTypeRSA3072   = "rsa-3072"
+	sshKeyTypeRSA4096   = "rsa-4096"
+	sshKeyTypeECDSAP256 = "ecdsa-p256"
+	sshKeyTypeECDSAP384 = "ecdsa-p384"
+	sshKeyTypeED25519   = "ed25519"
+	defaultSSHKeyType   = sshKeyTypeRSA4096
+)
+
+var sshKeyTypes = []string{sshKeyTypeRSA2048, sshKeyTypeRSA3072, sshKeyTypeRSA4096, sshKeyTypeECDSAP256, sshKeyTypeECDSAP384, sshKeyTypeED25519}
+
+// validSSHKeyType reports whether keyType is a supported --oci-ssh-key-type.
+func validSSHKeyType(keyType string) bool {
+	for _, t := range sshKeyTypes {
+		if t == keyType {
+			return true
+		}
+	}
+	return false
+}
+
+// generateSSHKeyPair creates an SSH key pair of the given type. It returns the private
+// key in PEM format (PKCS#1 for RSA, OpenSSH otherwise) and the public key in
+// authorized_keys format.
+func generateSSHKeyPair(keyType string) ([]byte, []byte, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch keyType {
+	case sshKeyTypeRSA2048:
+		privateKey, err = generateRSAPrivateKey(2048)
+	case sshKeyTypeRSA3072:
+		privateKey, err = generateRSAPrivateKey(3072)
+	case sshKeyTypeRSA4096:
+		privateKey, err = generateRSAPrivateKey(4096)
+	case sshKeyTypeECDSAP256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case sshKeyTypeECDSAP384:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case sshKeyTypeED25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, nil, fmt.Errorf("unsupported SSH key type %s", keyType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var block *pem.Block
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		block = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+		}
+	} else {
+		block, err = ssh.MarshalPrivateKey(privateKey, "")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return pem.EncodeToMemory(block), ssh.MarshalAuthorizedKey(publicKey), nil
+}
+
+func generateRSAPrivateKey(bitSize int) (*rsa.PrivateKey, error) {
+	// Private Key generation
+	privateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate RSA Private Key
+	err = privateKey.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
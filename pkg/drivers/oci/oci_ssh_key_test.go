@@ -0,0 +1,42 @@
+package oci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSSHKeyPair(t *testing.T) {
+	wantTypes := map[string]string{
+		sshKeyTypeRSA2048:   ssh.KeyAlgoRSA,
+		sshKeyTypeRSA3072:   ssh.KeyAlgoRSA,
+		sshKeyTypeRSA4096:   ssh.KeyAlgoRSA,
+		sshKeyTypeECDSAP256: ssh.KeyAlgoECDSA256,
+		sshKeyTypeECDSAP384: ssh.KeyAlgoECDSA384,
+		sshKeyTypeED25519:   ssh.KeyAlgoED25519,
+	}
+	require.Len(t, wantTypes, len(sshKeyTypes))
+
+	for _, keyType := range sshKeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			privateKeyBytes, publicKeyBytes, err := generateSSHKeyPair(keyType)
+			require.NoError(t, err)
+
+			// libmachine's SSH client loads the private key with ssh.ParsePrivateKey.
+			signer, err := ssh.ParsePrivateKey(privateKeyBytes)
+			require.NoError(t, err)
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyBytes)
+			require.NoError(t, err)
+
+			assert.Equal(t, wantTypes[keyType], publicKey.Type())
+			assert.Equal(t, publicKey.Marshal(), signer.PublicKey().Marshal())
+		})
+	}
+}
+
+func TestGenerateSSHKeyPairUnsupportedType(t *testing.T) {
+	_, _, err := generateSSHKeyPair("dsa")
+	assert.Error(t, err)
+}
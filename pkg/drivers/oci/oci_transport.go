@@ -0,0 +1,108 @@
+package oci
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+// hasCustomTransport reports whether API traffic needs a transport other than the SDK's default.
+func (d *Driver) hasCustomTransport() bool {
+	return d.IsRover || d.CABundleContent != "" || d.ProxyURL != "" || d.ClientCertContent != ""
+}
+
+// newTransport returns the HTTP transport for API traffic, which trusts the configured CAs,
+// presents the client certificate, and goes through the proxy.
+func (d *Driver) newTransport() (*http.Transport, error) {
+	if err := d.loadTransportSecrets(); err != nil {
+		return nil, err
+	}
+	pool, err := d.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{RootCAs: pool}
+	if d.ClientCertContent != "" {
+		cert, err := tls.X509KeyPair([]byte(d.ClientCertContent), []byte(d.ClientKeyContent))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate or key: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	proxy, err := d.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+	return transport, nil
+}
+
+// proxyFunc returns the proxy selection for API requests: the configured proxy except for
+// hosts matching the no-proxy list, or the proxy from the environment if none is configured.
+func (d *Driver) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if d.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(d.ProxyURL)
+	if err != nil {
+		// The parse error quotes the URL, which may hold the proxy password.
+		return nil, errors.New("invalid proxy URL (--oci-proxy-url), must be an http:// or https:// URL")
+	}
+	if proxyURL.Host == "" || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid proxy URL %q (--oci-proxy-url), must be an http:// or https:// URL", proxyURL.Redacted())
+	}
+	if d.ProxyUsername != "" {
+		proxyURL.User = url.UserPassword(d.ProxyUsername, d.ProxyPassword)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy(req.URL.Hostname(), d.NoProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// noProxy reports whether a host matches a comma-separated no-proxy list of host names,
+// domain suffixes (with or without a leading dot), IP addresses and CIDR blocks, or "*".
+func noProxy(host, list string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && ip != nil && cidr.Contains(ip) {
+				return true
+			}
+		default:
+			entry = strings.TrimPrefix(entry, ".")
+			if host == entry || strings.HasSuffix(host, "."+entry) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setTransport makes a client send its requests through the given transport.
+func setTransport(client *common.BaseClient, transport *http.Transport) error {
+	h, ok := client.HTTPClient.(*http.Client)
+	if !ok {
+		return fmt.Errorf("cannot configure transport of %s: HTTP dispatcher is %T, not *http.Client", client.Host, client.HTTPClient)
+	}
+	h.Transport = transport
+	return nil
+}
@@ -0,0 +1,250 @@
+package oci
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rancher/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	localhost          = "127.0.0.1"
+	jumpKnownHostsFile = "jump_known_hosts"
+
+	// sshTunnelIdleTimeout is how long the tunnel is kept open without any connection.
+	// Provisioning opens a new SSH connection for each command, so the tunnel only goes
+	// idle for that long once provisioning is done.
+	sshTunnelIdleTimeout = 2 * time.Minute
+)
+
+// usesSSHTunnel reports whether the node is reached over SSH through a bastion session or jump host.
+func (d *Driver) usesSSHTunnel() bool {
+	return d.BastionID != "" || d.JumpHost != ""
+}
+
+// ensureSSHTunnel makes sure there is a local listener that forwards connections to the
+// node's SSH port through the bastion session or jump host, ProxyJump-style. It returns
+// the local port of the tunnel.
+func (d *Driver) ensureSSHTunnel() (int, error) {
+	d.sshTunnelLock.Lock()
+	defer d.sshTunnelLock.Unlock()
+
+	if d.sshTunnelPort != 0 {
+		return d.sshTunnelPort, nil
+	}
+
+	oci, err := d.initOCIClient()
+	if err != nil {
+		return 0, err
+	}
+	targetIP, err := oci.GetInstanceIP(d.InstanceID, d.NodeCompartmentID, true)
+	if err != nil {
+		return 0, err
+	}
+	targetPort := d.SSHPort
+	if targetPort == 0 {
+		targetPort = defaultSSHPort
+	}
+
+	var hop string
+	var config *ssh.ClientConfig
+	if d.BastionID != "" {
+		hop, config, err = d.bastionSSHConfig(oci, targetIP, targetPort)
+	} else {
+		hop, config, err = d.jumpHostSSHConfig()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+	if err != nil {
+		return 0, err
+	}
+	target := net.JoinHostPort(targetIP, strconv.Itoa(targetPort))
+	var checkTarget func(*ssh.Client) error
+	if d.PinHostKeys {
+		checkTarget = func(hop *ssh.Client) error { return d.checkPinnedHostKey(hop, target) }
+	}
+	go forwardThroughSSH(listener, hop, config, target, checkTarget, sshTunnelIdleTimeout, d.closeSSHTunnel)
+
+	d.sshTunnelPort = listener.Addr().(*net.TCPAddr).Port
+	log.Debugf("Forwarding %s:%d to %s through %s", localhost, d.sshTunnelPort, target, hop)
+
+	return d.sshTunnelPort, nil
+}
+
+// closeSSHTunnel forgets the tunnel once its listener is closed, and deletes the bastion
+// session behind it. A later SSH connection sets up a new tunnel and session.
+func (d *Driver) closeSSHTunnel() {
+	d.sshTunnelLock.Lock()
+	defer d.sshTunnelLock.Unlock()
+
+	log.Debugf("Closed idle SSH tunnel on %s:%d", localhost, d.sshTunnelPort)
+	d.sshTunnelPort = 0
+	if d.BastionSessionID == "" {
+		return
+	}
+
+	oci, err := d.initOCIClient()
+	if err == nil {
+		err = oci.DeleteBastionSession(d.BastionSessionID)
+	}
+	if err != nil {
+		log.Warnf("Could not delete bastion session %s: %v", d.BastionSessionID, err)
+		return
+	}
+	d.BastionSessionID = ""
+}
+
+// bastionSSHConfig makes sure there is an active bastion session for the node and returns
+// the address of the bastion host and the SSH configuration to log into the session.
+func (d *Driver) bastionSSHConfig(oci Client, targetIP string, targetPort int) (string, *ssh.ClientConfig, error) {
+	signer, err := readSigner(d.GetSSHKeyPath())
+	if err != nil {
+		return "", nil, err
+	}
+
+	active := false
+	if d.BastionSessionID != "" {
+		active, err = oci.IsBastionSessionActive(d.BastionSessionID)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if !active {
+		if d.BastionSessionID != "" {
+			// The previous session expired, don't leave it behind.
+			_ = oci.DeleteBastionSession(d.BastionSessionID)
+		}
+		d.BastionSessionID, err = oci.CreateBastionSession(d.BastionID, d.BastionSessionType, d.MachineName, d.InstanceID,
+			targetIP, d.GetSSHUsername(), targetPort, d.BastionSessionTTL, string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	hop := net.JoinHostPort(oci.bastionSSHHost(), strconv.Itoa(bastionSSHPort))
+	config := &ssh.ClientConfig{
+		User: d.BastionSessionID,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		// The Bastion service does not publish its host keys, so there is nothing to check
+		// them against. The bastion only relays a separate, end-to-end encrypted SSH
+		// connection to the node, whose host key the tunnel checks with --oci-pin-host-keys.
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	return hop, config, nil
+}
+
+// jumpHostSSHConfig returns the address of the jump host and the SSH configuration to log
+// into it, checking its host key against the supplied known_hosts entry.
+func (d *Driver) jumpHostSSHConfig() (string, *ssh.ClientConfig, error) {
+	err := reloadSecret(&d.JumpHostKeyContents, d.JumpHostKeyPath, "OCI_JUMP_HOST_KEY_CONTENTS", "jump host key", "oci-jump-host-key")
+	if err != nil {
+		return "", nil, err
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(d.JumpHostKeyContents))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not parse jump host private key: %v", err)
+	}
+
+	knownHostsPath := d.ResolveStorePath(jumpKnownHostsFile)
+	err = ioutil.WriteFile(knownHostsPath, []byte(d.JumpHostKnownHosts+"\n"), 0600)
+	if err != nil {
+		return "", nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid jump host known_hosts entry: %v", err)
+	}
+
+	hop := net.JoinHostPort(d.JumpHost, strconv.Itoa(d.JumpHostPort))
+	config := &ssh.ClientConfig{
+		User:            d.JumpHostUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}
+	return hop, config, nil
+}
+
+// readSigner reads an SSH private key file.
+func readSigner(path string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse SSH private key %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// forwardThroughSSH accepts local connections and forwards each of them to target over
+// an SSH connection to the hop host. If checkTarget is set, it must accept the target
+// before a connection is forwarded. Once no connection has been open for idleTimeout,
+// it closes the listener and calls onClose.
+func forwardThroughSSH(listener net.Listener, hop string, config *ssh.ClientConfig, target string,
+	checkTarget func(*ssh.Client) error, idleTimeout time.Duration, onClose func()) {
+	var lock sync.Mutex
+	active := 0
+	idle := time.AfterFunc(idleTimeout, func() { _ = listener.Close() })
+	defer onClose()
+
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			log.Debugf("SSH tunnel listener closed: %v", err)
+			return
+		}
+		lock.Lock()
+		active++
+		idle.Stop()
+		lock.Unlock()
+
+		go func() {
+			defer func() {
+				lock.Lock()
+				active--
+				if active == 0 {
+					idle.Reset(idleTimeout)
+				}
+				lock.Unlock()
+			}()
+			defer local.Close()
+
+			client, err := ssh.Dial("tcp", hop, config)
+			if err != nil {
+				log.Debugf("could not connect to %s: %v", hop, err)
+				return
+			}
+			defer client.Close()
+
+			if checkTarget != nil {
+				if err := checkTarget(client); err != nil {
+					log.Warnf("Not forwarding SSH connection to %s: %v", target, err)
+					return
+				}
+			}
+
+			remote, err := client.Dial("tcp", target)
+			if err != nil {
+				log.Debugf("could not connect to %s through %s: %v", target, hop, err)
+				return
+			}
+			defer remote.Close()
+
+			done := make(chan struct{}, 2)
+			go func() { _, _ = io.Copy(remote, local); done <- struct{}{} }()
+			go func() { _, _ = io.Copy(local, remote); done <- struct{}{} }()
+			<-done
+		}()
+	}
+}
@@ -0,0 +1,124 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/example/helpers"
+	"github.com/rancher/machine/libmachine/log"
+)
+
+const autoPrivateIP = "auto"
+
+// SecondaryVnic describes a VNIC to attach to the node in addition to its primary VNIC.
+type SecondaryVnic struct {
+	SubnetID  string
+	NSGIDs    []string
+	PrivateIP string
+}
+
+// parseSecondaryVnic parses a --oci-node-secondary-vnic value of the form
+// subnet=<ocid>[,nsg=<ocid>...][,private-ip=<address>].
+func parseSecondaryVnic(spec string) (SecondaryVnic, error) {
+	var vnic SecondaryVnic
+	for _, field := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return SecondaryVnic{}, fmt.Errorf("invalid secondary VNIC %q (--oci-node-secondary-vnic), expected key=value pairs", spec)
+		}
+		switch kv[0] {
+		case "subnet":
+			vnic.SubnetID = kv[1]
+		case "nsg":
+			vnic.NSGIDs = append(vnic.NSGIDs, kv[1])
+		case "private-ip":
+			if net.ParseIP(kv[1]) == nil {
+				return SecondaryVnic{}, fmt.Errorf("invalid private IP address %q in secondary VNIC (--oci-node-secondary-vnic)", kv[1])
+			}
+			vnic.PrivateIP = kv[1]
+		default:
+			return SecondaryVnic{}, fmt.Errorf("unknown key %q in secondary VNIC (--oci-node-secondary-vnic), must be subnet, nsg or private-ip", kv[0])
+		}
+	}
+	if vnic.SubnetID == "" {
+		return SecondaryVnic{}, fmt.Errorf("no subnet specified for secondary VNIC %q (--oci-node-secondary-vnic)", spec)
+	}
+
+	return vnic, nil
+}
+
+// AttachSecondaryVnics attaches additional VNICs to a compute instance and waits for
+// each of them to be attached.
+func (c *Client) AttachSecondaryVnics(id, displayName string, vnics []SecondaryVnic) error {
+	for i, vnic := range vnics {
+		vnicName := fmt.Sprintf("%s-vnic%d", displayName, i+1)
+		details := &core.CreateVnicDetails{
+			SubnetId:       common.String(vnic.SubnetID),
+			DisplayName:    &vnicName,
+			AssignPublicIp: common.Bool(false),
+			NsgIds:         vnic.NSGIDs,
+		}
+		if vnic.PrivateIP != "" {
+			details.PrivateIp = common.String(vnic.PrivateIP)
+		}
+
+		log.Infof("Attaching secondary VNIC %s in subnet %s", vnicName, vnic.SubnetID)
+		attachResp, err := c.computeClient.AttachVnic(context.Background(), core.AttachVnicRequest{
+			AttachVnicDetails: core.AttachVnicDetails{
+				InstanceId:        &id,
+				DisplayName:       &vnicName,
+				CreateVnicDetails: details,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		// wait until lifecycle status is Attached
+		pollUntilAttached := func(r common.OCIOperationResponse) bool {
+			if converted, ok := r.Response.(core.GetVnicAttachmentResponse); ok {
+				return converted.LifecycleState != core.VnicAttachmentLifecycleStateAttached
+			}
+			return true
+		}
+
+		_, err = c.computeClient.GetVnicAttachment(context.Background(), core.GetVnicAttachmentRequest{
+			VnicAttachmentId: attachResp.Id,
+			RequestMetadata:  helpers.GetRequestMetadataWithCustomizedRetryPolicy(pollUntilAttached),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AssignSecondaryPrivateIPs adds secondary private IPs to the primary VNIC of a compute
+// instance. An address of "auto" lets OCI pick a free address in the subnet.
+func (c *Client) AssignSecondaryPrivateIPs(id, compartmentID string, addresses []string) error {
+	vnic, err := c.getPrimaryVnic(id, compartmentID)
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		details := core.CreatePrivateIpDetails{VnicId: vnic.Id}
+		if address != autoPrivateIP {
+			details.IpAddress = common.String(address)
+		}
+		resp, err := c.virtualNetworkClient.CreatePrivateIp(context.Background(), core.CreatePrivateIpRequest{
+			CreatePrivateIpDetails: details,
+		})
+		if err != nil {
+			return err
+		}
+		log.Infof("Assigned secondary private IP %s", *resp.IpAddress)
+	}
+
+	return nil
+}